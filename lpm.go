@@ -1,11 +1,14 @@
 package golpm
 
 import (
+	"bytes"
 	"net"
+	"time"
 )
 
 const (
 	ArchRadix = "radix"
+	ArchArena = "arena"
 )
 
 type LPMTable interface {
@@ -14,14 +17,47 @@ type LPMTable interface {
 	AddIPNet(prefix *net.IPNet, entry interface{}) error
 	Delete(prefix string) error
 	DeleteIPNet(prefix *net.IPNet) error
+	AddRange(start, end net.IP, entry interface{}) error
+	DeleteRange(start, end net.IP) error
 	Lookup(ip string) *Entry
 	LookupIP(ip net.IP) *Entry
 }
 
-// Entry An entry in entries table
+// PrefixGetter A lpm table returning the entry of exactly a prefix.
+// The tables of this package implement it.
+type PrefixGetter interface {
+	Get(prefix string) *Entry
+	GetIPNet(prefix *net.IPNet) *Entry
+}
+
+// getIPNet Return the entry of exactly prefix in table, through GetIPNet
+// when the table implements it
+func getIPNet(table LPMTable, prefix *net.IPNet) *Entry {
+	if getter, ok := table.(PrefixGetter); ok {
+		return getter.GetIPNet(prefix)
+	}
+	maskSize, _ := prefix.Mask.Size()
+	for _, entry := range table.Show()[maskSize] {
+		if entry.Prefix.IP.Equal(prefix.IP) && bytes.Equal(entry.Prefix.Mask, prefix.Mask) {
+			return &entry
+		}
+	}
+	return nil
+}
+
+// Entry An entry in entries table.
+// Range is the original range for entries added by AddRange, nil otherwise.
+// Except lists the sub-prefixes the entry does not apply to.
+// Expires is the expiry time of entries added with a TTL, zero otherwise.
+// Source is the source the entry was added on behalf of, if any.
 type Entry struct {
-	Prefix *net.IPNet
-	Entry  interface{}
+	Prefix  *net.IPNet
+	Entry   interface{}
+	Range   *IPRange
+	Except  []*net.IPNet
+	Type    RouteType
+	Expires time.Time
+	Source  string
 }
 
 // NewLPMTable Create a lpm table based on specify arch.
@@ -32,19 +68,42 @@ func NewLPMTable(arch string, isIPv6 bool) LPMTable {
 	}
 	switch arch {
 	case ArchRadix:
-		return &RadixTable{
-			ipBytesLen: ipBytesLen,
-			root:       &radixNode{},
-		}
+		return newRadixTable(ipBytesLen, nil)
+	case ArchArena:
+		return newArenaTable(ipBytesLen)
 	default:
-		return &RadixTable{
-			ipBytesLen: ipBytesLen,
-			root:       &radixNode{},
-		}
+		return newRadixTable(ipBytesLen, nil)
 	}
 }
 
 // NewRadixLPMTable Create a lpm table based on radix arch.
-func NewRadixLPMTable(isIPv6 bool) LPMTable {
-	return NewLPMTable(ArchRadix, isIPv6)
+func NewRadixLPMTable(isIPv6 bool, opts ...RadixOption) LPMTable {
+	table := NewLPMTable(ArchRadix, isIPv6)
+	for _, opt := range opts {
+		opt(table.(*RadixTable))
+	}
+	return table
+}
+
+// tableIPBytesLen Return the address length of table, or 0 when unknown
+func tableIPBytesLen(table LPMTable) int {
+	if rt, ok := table.(*RadixTable); ok && rt.ipBytesLen != 0 {
+		return rt.ipBytesLen
+	}
+	if at, ok := table.(*ArenaTable); ok {
+		return at.ipBytesLen
+	}
+	if _, ok := table.(*DualTable); ok {
+		// both families fit an ipv6 address, ipv4 in ::/96
+		return net.IPv6len
+	}
+	for _, entries := range table.Show() {
+		for _, entry := range entries {
+			if entry.Prefix.IP.To4() != nil {
+				return net.IPv4len
+			}
+			return net.IPv6len
+		}
+	}
+	return 0
 }
@@ -0,0 +1,301 @@
+package golpm
+
+import (
+	"net"
+	"reflect"
+)
+
+// EqualFunc Report whether two entries are equivalent
+type EqualFunc func(x, y interface{}) bool
+
+func equalOrDefault(eq EqualFunc) EqualFunc {
+	if eq == nil {
+		return reflect.DeepEqual
+	}
+	return eq
+}
+
+const noRoute = -1
+
+// bitNode A node of a one-bit trie used to rewrite tables
+type bitNode struct {
+	children [2]*bitNode
+	entry    *Entry
+	hole     bool  // an excluded prefix without route to fall through to
+	set      []int // candidate value classes, sorted, nil for any class
+}
+
+// bitTrie A one-bit trie holding the entries of a table
+type bitTrie struct {
+	root *bitNode
+	bits int
+}
+
+func newBitTrie(rt *RadixTable) *bitTrie {
+	trie := &bitTrie{
+		root: &bitNode{},
+		bits: rt.ipBytesLen * 8,
+	}
+	rt.Walk(func(entry *Entry) bool {
+		node := trie.node(entry.Prefix)
+		node.entry, node.hole = entry, false
+		if entry.excludesPrefix(entry.Prefix) {
+			node.entry = fallbackEntry(rt, entry.Prefix)
+			node.hole = node.entry == nil
+		}
+		// excluded prefixes get the entry a lookup falls through to, unless
+		// an entry of their own is walked later
+		for _, exceptNet := range entry.Except {
+			node := trie.node(exceptNet)
+			if node.entry == nil && !node.hole {
+				node.entry = fallbackEntry(rt, exceptNet)
+				node.hole = node.entry == nil
+			}
+		}
+		return true
+	})
+	return trie
+}
+
+// node Return the node of prefix, creating the path to it
+func (bt *bitTrie) node(prefix *net.IPNet) *bitNode {
+	maskSize, bits := prefix.Mask.Size()
+	bt.bits = bits
+	ip := prefix.IP
+	if bits == 32 {
+		ip = ip.To4()
+	}
+	node := bt.root
+	for depth := 0; depth < maskSize; depth++ {
+		bit := ip[depth/8] >> (7 - depth%8) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &bitNode{}
+		}
+		node = node.children[bit]
+	}
+	return node
+}
+
+func (bt *bitTrie) prefix(ip []byte, depth int) *net.IPNet {
+	return &net.IPNet{
+		IP:   append(net.IP(nil), ip...),
+		Mask: net.CIDRMask(depth, bt.bits),
+	}
+}
+
+// emit Add the entries of the trie to a new table like rt
+func (bt *bitTrie) emit(rt *RadixTable) *RadixTable {
+	table := rt.emptyLike()
+	ip := make([]byte, bt.bits/8)
+	var ancestors []*Entry
+	var emit func(node *bitNode, depth int)
+	emit = func(node *bitNode, depth int) {
+		if node == nil {
+			return
+		}
+		if node.entry != nil {
+			entry := &Entry{
+				Prefix: bt.prefix(ip, depth),
+				Entry:  node.entry.Entry,
+				Type:   node.entry.Type,
+			}
+			table.insert(entry)
+			ancestors = append(ancestors, entry)
+			defer func() { ancestors = ancestors[:len(ancestors)-1] }()
+		} else if node.hole {
+			// no route here, so every covering entry must exclude it
+			prefix := bt.prefix(ip, depth)
+			for _, entry := range ancestors {
+				entry.Except = append(entry.Except, prefix)
+			}
+			// lookups inside the hole fall through all of them
+			outer := ancestors
+			ancestors = nil
+			defer func() { ancestors = outer }()
+		}
+		emit(node.children[0], depth+1)
+		if node.children[1] != nil {
+			ip[depth/8] |= 0x80 >> (depth % 8)
+			emit(node.children[1], depth+1)
+			ip[depth/8] &^= 0x80 >> (depth % 8)
+		}
+	}
+	emit(bt.root, 0)
+	return table
+}
+
+// Aggregate Return a new table with the minimum number of prefixes that
+// gives the same lookup result as rt for every address, entries being
+// compared with eq (reflect.DeepEqual when nil). It implements the
+// Optimal Routing Table Constructor, with the restriction that an address
+// without route in rt is never covered by a prefix of the new table, unless
+// rt excludes it from an entry: the covering prefix then excludes it too.
+func (rt *RadixTable) Aggregate(eq EqualFunc) *RadixTable {
+	eq = equalOrDefault(eq)
+	trie := newBitTrie(rt)
+
+	var values []*Entry
+	classOf := func(entry *Entry) int {
+		for i, v := range values {
+			if v.Type == entry.Type && eq(v.Entry, entry.Entry) {
+				return i
+			}
+		}
+		values = append(values, entry)
+		return len(values) - 1
+	}
+
+	// pass 1 and 2: expand to a full binary trie, then compute the
+	// candidate classes of each node from the bottom up. A hole takes any
+	// class, as the prefixes covering it are emitted with it excluded.
+	var prepare func(node *bitNode, inherited int) bool
+	prepare = func(node *bitNode, inherited int) (noRouteBelow bool) {
+		if node.entry != nil {
+			inherited = classOf(node.entry)
+			node.entry = nil
+		} else if node.hole {
+			inherited = noRoute
+		}
+		if node.children[0] == nil && node.children[1] == nil {
+			if node.hole {
+				return false
+			}
+			node.set = []int{inherited}
+			return inherited == noRoute
+		}
+		for bit := range node.children {
+			if node.children[bit] == nil {
+				node.children[bit] = &bitNode{}
+			}
+			if prepare(node.children[bit], inherited) {
+				noRouteBelow = true
+			}
+		}
+		if node.hole {
+			return false
+		}
+		if noRouteBelow {
+			// a prefix covering an address without route cannot be expressed
+			node.set = []int{noRoute}
+			return true
+		}
+		left, right := node.children[0].set, node.children[1].set
+		switch {
+		case left == nil:
+			node.set = right
+		case right == nil:
+			node.set = left
+		default:
+			node.set = intersectSorted(left, right)
+			if len(node.set) == 0 {
+				node.set = unionSorted(left, right)
+			}
+		}
+		return false
+	}
+	prepare(trie.root, noRoute)
+
+	// pass 3: choose a class from the top down, keeping the inherited one
+	// whenever possible
+	var choose func(node *bitNode, inherited int)
+	choose = func(node *bitNode, inherited int) {
+		chosen := inherited
+		if node.set != nil && !containsSorted(node.set, inherited) {
+			chosen = node.set[0]
+			node.entry = values[chosen]
+		}
+		node.set = nil
+		if node.hole {
+			chosen = noRoute
+		}
+		for _, child := range node.children {
+			if child != nil {
+				choose(child, chosen)
+			}
+		}
+	}
+	choose(trie.root, noRoute)
+
+	return trie.emit(rt)
+}
+
+// MergeSiblings Return a new table where every pair of sibling prefixes
+// with equivalent entries is replaced by their parent prefix, repeatedly.
+// It is cheaper than Aggregate but does not guarantee a minimal table.
+func (rt *RadixTable) MergeSiblings(eq EqualFunc) *RadixTable {
+	eq = equalOrDefault(eq)
+	trie := newBitTrie(rt)
+
+	var merge func(node *bitNode)
+	merge = func(node *bitNode) {
+		left, right := node.children[0], node.children[1]
+		if left != nil {
+			merge(left)
+		}
+		if right != nil {
+			merge(right)
+		}
+		if left == nil || right == nil || left.entry == nil || right.entry == nil {
+			return
+		}
+		if left.entry.Type == right.entry.Type && eq(left.entry.Entry, right.entry.Entry) {
+			// the siblings shadow any entry of the parent
+			node.entry = left.entry
+			left.entry = nil
+			right.entry = nil
+		}
+	}
+	merge(trie.root)
+
+	return trie.emit(rt)
+}
+
+func containsSorted(set []int, v int) bool {
+	for _, s := range set {
+		if s == v {
+			return true
+		}
+		if s > v {
+			return false
+		}
+	}
+	return false
+}
+
+func intersectSorted(a, b []int) []int {
+	var out []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+func unionSorted(a, b []int) []int {
+	out := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			out = append(out, a[i])
+			i++
+		case a[i] > b[j]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
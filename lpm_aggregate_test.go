@@ -0,0 +1,174 @@
+package golpm
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func tableSize(table LPMTable) int {
+	size := 0
+	for _, entries := range table.Show() {
+		size += len(entries)
+	}
+	return size
+}
+
+func TestRadixTable_Aggregate(t *testing.T) {
+	Convey("Aggregate adjacent siblings", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		table.Add("10.0.0.0/25", "a")
+		table.Add("10.0.0.128/25", "a")
+		table.Add("10.0.1.0/24", "a")
+		table.Add("10.0.2.0/24", "b")
+
+		aggregated := table.Aggregate(nil)
+		So(tableSize(aggregated), ShouldEqual, 2)
+		So(aggregated.Get("10.0.0.0/23").Entry, ShouldEqual, "a")
+		So(aggregated.Get("10.0.2.0/24").Entry, ShouldEqual, "b")
+
+		merged := table.MergeSiblings(nil)
+		So(tableSize(merged), ShouldEqual, 2)
+		So(merged.Get("10.0.0.0/23").Entry, ShouldEqual, "a")
+	})
+
+	Convey("Aggregate shadowed and redundant prefixes", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		table.Add("10.0.0.0/24", "a")
+		table.Add("10.0.0.0/25", "b")
+		table.Add("10.0.0.128/26", "b")
+		table.Add("10.0.0.192/26", "b")
+		table.Add("10.0.0.7/32", "b")
+
+		aggregated := table.Aggregate(nil)
+		So(tableSize(aggregated), ShouldEqual, 1)
+		So(aggregated.Get("10.0.0.0/24").Entry, ShouldEqual, "b")
+
+		merged := table.MergeSiblings(nil)
+		So(tableSize(merged), ShouldEqual, 2)
+		So(merged.Get("10.0.0.0/24").Entry, ShouldEqual, "b")
+		So(merged.Get("10.0.0.7/32").Entry, ShouldEqual, "b")
+	})
+
+	Convey("Aggregate with a default route", t, func() {
+		table := NewRadixLPMTable(true).(*RadixTable)
+		table.Add("::/0", "a")
+		table.Add("2001:db8::/33", "b")
+		table.Add("2001:db8:8000::/33", "b")
+		table.Add("2001:db8::/48", "a")
+
+		aggregated := table.Aggregate(nil)
+		So(tableSize(aggregated), ShouldEqual, 3)
+		So(aggregated.Get("::/0").Entry, ShouldEqual, "a")
+		So(aggregated.Get("2001:db8::/32").Entry, ShouldEqual, "b")
+		So(aggregated.Get("2001:db8::/48").Entry, ShouldEqual, "a")
+	})
+
+	Convey("Aggregate with an equality function", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		table.Add("10.0.0.0/25", "gw1 metric 10")
+		table.Add("10.0.0.128/25", "gw1 metric 20")
+		sameGateway := func(x, y interface{}) bool {
+			return x.(string)[:3] == y.(string)[:3]
+		}
+		So(tableSize(table.Aggregate(sameGateway)), ShouldEqual, 1)
+		So(tableSize(table.Aggregate(nil)), ShouldEqual, 2)
+		So(tableSize(table.MergeSiblings(sameGateway)), ShouldEqual, 1)
+	})
+
+	Convey("Aggregate with excluded prefixes", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		So(table.AddExcept("10.0.0.0/8", []string{"10.1.0.0/16"}, "a"), ShouldBeNil)
+		So(table.AddExcept("10.2.0.0/16", []string{"10.2.3.0/24"}, "a"), ShouldBeNil)
+		So(table.AddExcept("10.1.2.0/24", []string{"10.1.2.128/25"}, "b"), ShouldBeNil)
+
+		aggregated := table.Aggregate(nil)
+		So(tableSize(aggregated), ShouldBeLessThanOrEqualTo, tableSize(table))
+		So(aggregated.Get("10.0.0.0/8").Entry, ShouldEqual, "a")
+		So(aggregated.Get("10.1.2.0/24").Entry, ShouldEqual, "b")
+		So(aggregated.Lookup("10.1.2.1").Entry, ShouldEqual, "b")
+		So(aggregated.Lookup("10.1.2.129"), ShouldBeNil)
+		So(aggregated.Lookup("10.1.3.1"), ShouldBeNil)
+		So(aggregated.Lookup("10.2.3.1").Entry, ShouldEqual, "a")
+
+		single := NewRadixLPMTable(false).(*RadixTable)
+		So(single.AddExcept("10.0.0.0/8", []string{"10.1.0.0/16"}, "a"), ShouldBeNil)
+		So(tableSize(single.Aggregate(nil)), ShouldEqual, 1)
+	})
+
+	Convey("Aggregate random tables with excluded prefixes", t, func() {
+		rnd := rand.New(rand.NewSource(3))
+		randomPrefix := func(minLen int) *net.IPNet {
+			maskLen := minLen + rnd.Intn(33-minLen)
+			ip := net.IPv4(10, 0, byte(rnd.Intn(4)), byte(rnd.Intn(256)))
+			return &net.IPNet{IP: ip.Mask(net.CIDRMask(maskLen, 32)), Mask: net.CIDRMask(maskLen, 32)}
+		}
+		for round := 0; round < 20; round++ {
+			table := NewRadixLPMTable(false).(*RadixTable)
+			for i := 0; i < 40; i++ {
+				prefix := randomPrefix(16)
+				var except []*net.IPNet
+				for j := rnd.Intn(3); j > 0; j-- {
+					sub := randomPrefix(16)
+					if size, _ := sub.Mask.Size(); prefix.Contains(sub.IP) && size > 16 {
+						except = append(except, sub)
+					}
+				}
+				table.AddIPNetExcept(prefix, except, rnd.Intn(3))
+			}
+
+			aggregated := table.Aggregate(nil)
+			merged := table.MergeSiblings(nil)
+			So(tableSize(aggregated), ShouldBeLessThanOrEqualTo, tableSize(table))
+
+			for i := 0; i < 1<<11; i++ {
+				ip := fmt.Sprintf("10.0.%d.%d", i>>8&3, rnd.Intn(256))
+				want := table.Lookup(ip)
+				for _, got := range []*Entry{aggregated.Lookup(ip), merged.Lookup(ip)} {
+					if want == nil {
+						So(got, ShouldBeNil)
+					} else {
+						So(got, ShouldNotBeNil)
+						So(got.Entry, ShouldEqual, want.Entry)
+					}
+				}
+			}
+		}
+	})
+
+	Convey("Aggregate random tables", t, func() {
+		rnd := rand.New(rand.NewSource(1))
+		for round := 0; round < 20; round++ {
+			table := NewRadixLPMTable(false).(*RadixTable)
+			for i := 0; i < 60; i++ {
+				maskLen := 16 + rnd.Intn(17)
+				ip := net.IPv4(10, 0, byte(rnd.Intn(4)), byte(rnd.Intn(256)))
+				table.AddIPNet(&net.IPNet{IP: ip.Mask(net.CIDRMask(maskLen, 32)), Mask: net.CIDRMask(maskLen, 32)}, rnd.Intn(3))
+			}
+			if round%2 == 0 {
+				table.Add("0.0.0.0/0", 0)
+			}
+
+			aggregated := table.Aggregate(nil)
+			merged := table.MergeSiblings(nil)
+			So(tableSize(aggregated), ShouldBeLessThanOrEqualTo, tableSize(merged))
+			So(tableSize(merged), ShouldBeLessThanOrEqualTo, tableSize(table))
+
+			for i := 0; i < 1<<11; i++ {
+				ip := fmt.Sprintf("10.%d.%d.%d", i>>10, i>>8&3, rnd.Intn(256))
+				want := table.Lookup(ip)
+				for _, got := range []*Entry{aggregated.Lookup(ip), merged.Lookup(ip)} {
+					if want == nil {
+						So(got, ShouldBeNil)
+					} else {
+						So(got, ShouldNotBeNil)
+						So(got.Entry, ShouldEqual, want.Entry)
+					}
+				}
+			}
+		}
+	})
+}
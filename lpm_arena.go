@@ -0,0 +1,672 @@
+package golpm
+
+import (
+	mathbits "math/bits"
+	"net"
+)
+
+// ArenaTable A radix table with 8-bit strides whose nodes and entries live
+// in a few big slices addressed by uint32 indexes instead of pointers, so
+// that the garbage collector has almost nothing to scan however big the
+// table grows. Only the entry values, held in one []interface{} the
+// collector still scans, and the ranges and excluded prefixes of the
+// entries are kept as pointers; values without pointers, such as small
+// integers indexing a side table, keep that scan cheap.
+//
+// LookupValue is the lookup to use: it returns the value without
+// allocating. The methods returning *Entry build a new Entry on every
+// call, one allocation each, so the same prefix gives a different pointer
+// each time and changing the Entry does not change the table.
+type ArenaTable struct {
+	ipBytesLen int
+	nodes      []arenaNode // nodes[0] is the root
+	freeNodes  []uint32
+	// child blocks of the nodes, a block of 1<<class slots starting at
+	// its offset, free blocks kept by class for reuse
+	slots      []uint32
+	freeBlocks [arenaDense + 1][]uint32
+	// entries[0] is unused, index 0 meaning no entry
+	entries      []arenaEntry
+	values       []interface{}
+	freeEntries  []uint32
+	extras       map[uint32]*arenaExtra
+	defaultEntry uint32
+	fallback     LPMTable // lookup table of throw routes
+}
+
+// arenaDense The class of the blocks storing a slot per child index.
+// Blocks of smaller classes store the children packed in index order,
+// and a node goes back to packed below arenaPackedMax/2 children.
+const (
+	arenaDense     = 8
+	arenaPackedMax = 64
+)
+
+type arenaNode struct {
+	bitmap   [4]uint64 // child indexes present
+	block    uint32
+	class    uint8
+	entryCnt uint8
+	childCnt uint16
+	entries  [8]uint32 // routing entries stored by the node
+}
+
+type arenaEntry struct {
+	ip      [net.IPv6len]byte
+	maskLen uint8
+	typ     uint8
+	extra   bool // has ranges or excluded prefixes in extras
+}
+
+type arenaExtra struct {
+	Range  *IPRange
+	Except []*net.IPNet
+}
+
+// NewArenaLPMTable Create a lpm table based on arena arch.
+func NewArenaLPMTable(isIPv6 bool) LPMTable {
+	return NewLPMTable(ArchArena, isIPv6)
+}
+
+func newArenaTable(ipBytesLen int) *ArenaTable {
+	return &ArenaTable{
+		ipBytesLen: ipBytesLen,
+		nodes:      make([]arenaNode, 1),
+		entries:    make([]arenaEntry, 1),
+		values:     make([]interface{}, 1),
+		extras:     make(map[uint32]*arenaExtra),
+	}
+}
+
+// child Return the child of node n at idx, 0 when missing
+func (at *ArenaTable) child(n uint32, idx byte) uint32 {
+	node := &at.nodes[n]
+	if node.childCnt == 0 {
+		return 0
+	}
+	if node.class == arenaDense {
+		return at.slots[node.block+uint32(idx)]
+	}
+	if node.bitmap[idx>>6]&(1<<(idx&63)) == 0 {
+		return 0
+	}
+	return at.slots[node.slot(idx)]
+}
+
+// slot Return the position in slots of the child at idx, its rank among
+// the children when they are packed
+func (node *arenaNode) slot(idx byte) uint32 {
+	if node.class == arenaDense {
+		return node.block + uint32(idx)
+	}
+	w := idx >> 6
+	rank := mathbits.OnesCount64(node.bitmap[w] & (1<<(idx&63) - 1))
+	for i := byte(0); i < w; i++ {
+		rank += mathbits.OnesCount64(node.bitmap[i])
+	}
+	return node.block + uint32(rank)
+}
+
+// children Append the children of node n to dst in index order
+func (at *ArenaTable) children(n uint32, dst []uint32) []uint32 {
+	node := &at.nodes[n]
+	pos := node.block
+	for w, word := range node.bitmap {
+		for bits := word; bits != 0; bits &= bits - 1 {
+			if node.class == arenaDense {
+				pos = node.block + uint32(w<<6+mathbits.TrailingZeros64(bits))
+			}
+			dst = append(dst, at.slots[pos])
+			pos++
+		}
+	}
+	return dst
+}
+
+// setChild Add the child of node n at idx, or remove it when child is 0.
+// The block is updated in place, the children moving to a block of another
+// class only when their count outgrows the block or drops well below it.
+func (at *ArenaTable) setChild(n uint32, idx byte, child uint32) {
+	node := &at.nodes[n]
+	w, bit := idx>>6, uint64(1)<<(idx&63)
+	present := node.bitmap[w]&bit != 0
+	if present && child != 0 {
+		at.slots[node.slot(idx)] = child
+		return
+	} else if !present && child == 0 {
+		return
+	}
+
+	old := *node
+	node.bitmap[w] ^= bit
+	if child != 0 {
+		node.childCnt++
+	} else {
+		node.childCnt--
+	}
+
+	class := old.class
+	switch cnt := int(node.childCnt); {
+	case cnt == 0:
+		at.freeBlock(old.block, old.class)
+		node.block, node.class = 0, 0
+		return
+	case cnt > arenaPackedMax:
+		class = arenaDense
+	case old.class == arenaDense && cnt >= arenaPackedMax/2:
+	case old.childCnt == 0 || cnt > 1<<class || cnt*4 <= 1<<class:
+		class = uint8(mathbits.Len(uint(cnt - 1)))
+	}
+
+	if old.childCnt != 0 && class == old.class {
+		if class == arenaDense {
+			at.slots[node.block+uint32(idx)] = child
+			return
+		}
+		// shift the packed children after idx by one slot
+		pos, end := node.slot(idx), old.block+uint32(old.childCnt)
+		if child != 0 {
+			copy(at.slots[pos+1:end+1], at.slots[pos:end])
+			at.slots[pos] = child
+		} else {
+			copy(at.slots[pos:end-1], at.slots[pos+1:end])
+			at.slots[end-1] = 0
+		}
+		return
+	}
+
+	block := at.allocBlock(class)
+	node = &at.nodes[n]
+	node.block, node.class = block, class
+	for w, word := range node.bitmap {
+		for bits := word; bits != 0; bits &= bits - 1 {
+			i := byte(w<<6 + mathbits.TrailingZeros64(bits))
+			c := child
+			if i != idx {
+				c = at.slots[old.slot(i)]
+			}
+			at.slots[node.slot(i)] = c
+		}
+	}
+	if old.childCnt != 0 {
+		at.freeBlock(old.block, old.class)
+	}
+}
+
+func (at *ArenaTable) allocBlock(class uint8) uint32 {
+	size := 1 << class
+	if free := at.freeBlocks[class]; len(free) > 0 {
+		block := free[len(free)-1]
+		at.freeBlocks[class] = free[:len(free)-1]
+		stale := at.slots[block : block+uint32(size)]
+		for i := range stale {
+			stale[i] = 0
+		}
+		return block
+	}
+	block := uint32(len(at.slots))
+	at.slots = append(at.slots, make([]uint32, size)...)
+	return block
+}
+
+func (at *ArenaTable) freeBlock(block uint32, class uint8) {
+	at.freeBlocks[class] = append(at.freeBlocks[class], block)
+}
+
+func (at *ArenaTable) allocNode() uint32 {
+	if len(at.freeNodes) > 0 {
+		n := at.freeNodes[len(at.freeNodes)-1]
+		at.freeNodes = at.freeNodes[:len(at.freeNodes)-1]
+		at.nodes[n] = arenaNode{}
+		return n
+	}
+	at.nodes = append(at.nodes, arenaNode{})
+	return uint32(len(at.nodes) - 1)
+}
+
+// setEntry Store newEntry in slot e, allocating a slot when e is 0
+func (at *ArenaTable) setEntry(e uint32, newEntry *Entry) uint32 {
+	if e == 0 {
+		if len(at.freeEntries) > 0 {
+			e = at.freeEntries[len(at.freeEntries)-1]
+			at.freeEntries = at.freeEntries[:len(at.freeEntries)-1]
+		} else {
+			at.entries = append(at.entries, arenaEntry{})
+			at.values = append(at.values, nil)
+			e = uint32(len(at.entries) - 1)
+		}
+	}
+	maskSize, _ := newEntry.Prefix.Mask.Size()
+	entry := arenaEntry{
+		maskLen: uint8(maskSize),
+		typ:     uint8(newEntry.Type),
+		extra:   newEntry.Range != nil || newEntry.Except != nil,
+	}
+	copy(entry.ip[:], at.prefixBytes(newEntry.Prefix))
+	at.entries[e] = entry
+	at.values[e] = newEntry.Entry
+	if entry.extra {
+		at.extras[e] = &arenaExtra{Range: newEntry.Range, Except: newEntry.Except}
+	} else {
+		delete(at.extras, e)
+	}
+	return e
+}
+
+func (at *ArenaTable) freeEntry(e uint32) {
+	at.values[e] = nil
+	delete(at.extras, e)
+	at.freeEntries = append(at.freeEntries, e)
+}
+
+// arenaResult An Entry built from a slot with its prefix, allocated at once
+type arenaResult struct {
+	entry  Entry
+	prefix net.IPNet
+	buf    [2 * net.IPv6len]byte // address then mask of the prefix
+}
+
+// entry Build the Entry of slot e, nil for 0, in a single allocation
+func (at *ArenaTable) entry(e uint32) *Entry {
+	if e == 0 {
+		return nil
+	}
+	stored := &at.entries[e]
+	result := &arenaResult{}
+	n := at.ipBytesLen
+	copy(result.buf[:n], stored.ip[:n])
+	mask := result.buf[n : 2*n]
+	for i := 0; i < int(stored.maskLen); i++ {
+		mask[i/8] |= 0x80 >> (i % 8)
+	}
+	result.prefix = net.IPNet{IP: result.buf[:n:n], Mask: mask[:n:n]}
+	result.entry = Entry{
+		Prefix: &result.prefix,
+		Entry:  at.values[e],
+		Type:   RouteType(stored.typ),
+	}
+	if extra := at.extras[e]; extra != nil {
+		result.entry.Range, result.entry.Except = extra.Range, extra.Except
+	}
+	return &result.entry
+}
+
+// excludes Report whether ip is inside an excluded prefix of slot e
+func (at *ArenaTable) excludes(e uint32, ip net.IP) bool {
+	if !at.entries[e].extra {
+		return false
+	}
+	for _, exceptNet := range at.extras[e].Except {
+		if exceptNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (at *ArenaTable) prefixBytes(prefix *net.IPNet) []byte {
+	if at.ipBytesLen == net.IPv4len {
+		return prefix.IP.To4()
+	}
+	return prefix.IP
+}
+
+func (at *ArenaTable) walk(n uint32, fn func(e uint32) bool) bool {
+	for _, e := range at.nodes[n].entries {
+		if e != 0 && !fn(e) {
+			return false
+		}
+	}
+	var buf [256]uint32
+	for _, child := range at.children(n, buf[:0]) {
+		if !at.walk(child, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// Walk Call fn for each entry in prefix order until fn returns false
+func (at *ArenaTable) Walk(fn func(entry *Entry) bool) {
+	if at.defaultEntry != 0 && !fn(at.entry(at.defaultEntry)) {
+		return
+	}
+	at.walk(0, func(e uint32) bool {
+		return fn(at.entry(e))
+	})
+}
+
+// Show Return the lpm table in format: maskLen -> entry list
+func (at *ArenaTable) Show() map[int][]Entry {
+	entries := make(map[int][]Entry)
+	at.Walk(func(entry *Entry) bool {
+		maskSize, _ := entry.Prefix.Mask.Size()
+		entries[maskSize] = append(entries[maskSize], *entry)
+		return true
+	})
+	return entries
+}
+
+// Len Return the number of entries of the table
+func (at *ArenaTable) Len() int {
+	return len(at.entries) - 1 - len(at.freeEntries)
+}
+
+func (at *ArenaTable) Add(prefix string, entry interface{}) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return at.AddIPNet(ipNet, entry)
+}
+
+func (at *ArenaTable) AddIPNet(prefix *net.IPNet, entry interface{}) error {
+	return at.insert(&Entry{
+		Prefix: prefix,
+		Entry:  entry,
+	})
+}
+
+func (at *ArenaTable) AddTyped(prefix string, typ RouteType, entry interface{}) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return at.AddIPNetTyped(ipNet, typ, entry)
+}
+
+func (at *ArenaTable) AddIPNetTyped(prefix *net.IPNet, typ RouteType, entry interface{}) error {
+	return at.insert(&Entry{
+		Prefix: prefix,
+		Entry:  entry,
+		Type:   typ,
+	})
+}
+
+func (at *ArenaTable) AddExcept(prefix string, except []string, entry interface{}) error {
+	_, ipNet, excepts, err := parseExcept(prefix, except)
+	if err != nil {
+		return err
+	}
+	return at.AddIPNetExcept(ipNet, excepts, entry)
+}
+
+func (at *ArenaTable) AddIPNetExcept(prefix *net.IPNet, except []*net.IPNet, entry interface{}) error {
+	if err := checkExcept(prefix, except); err != nil {
+		return err
+	}
+	newEntry := &Entry{
+		Prefix: prefix,
+		Entry:  entry,
+	}
+	if len(except) != 0 {
+		newEntry.Except = append([]*net.IPNet(nil), except...)
+	}
+	return at.insert(newEntry)
+}
+
+// AddRange Add entry for every address of [start, end], like RadixTable
+func (at *ArenaTable) AddRange(start, end net.IP, entry interface{}) error {
+	start, end, err := normalizeRange(start, end)
+	if err != nil {
+		return err
+	}
+	if err = checkFamily(at.ipBytesLen, start, "add"); err != nil {
+		return err
+	}
+	prefixes, err := rangeToCIDRs(start, end)
+	if err != nil {
+		return err
+	}
+	ipRange := &IPRange{Start: start, End: end}
+	for _, prefix := range prefixes {
+		if err = at.insert(&Entry{Prefix: prefix, Entry: entry, Range: ipRange}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (at *ArenaTable) insert(newEntry *Entry) error {
+	prefix := newEntry.Prefix
+	if err := checkFamily(at.ipBytesLen, prefix.IP, "add"); err != nil {
+		return err
+	}
+
+	maskSize, _ := prefix.Mask.Size()
+	if maskSize == 0 {
+		at.defaultEntry = at.setEntry(at.defaultEntry, newEntry)
+		return nil
+	}
+
+	ipBytes := at.prefixBytes(prefix)
+	node := uint32(0)
+	for i := 0; i < (maskSize+7)/8; i++ {
+		child := at.child(node, ipBytes[i])
+		if child == 0 {
+			child = at.allocNode()
+			at.setChild(node, ipBytes[i], child)
+		}
+		node = child
+	}
+	entryIdx := (maskSize + 7) % 8
+	e := at.nodes[node].entries[entryIdx]
+	if e == 0 {
+		at.nodes[node].entryCnt++
+	}
+	e = at.setEntry(e, newEntry)
+	at.nodes[node].entries[entryIdx] = e
+	return nil
+}
+
+func (at *ArenaTable) Delete(prefix string) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return at.DeleteIPNet(ipNet)
+}
+
+// DeleteIPNet Delete the entry of prefix, putting its slot and the nodes
+// left empty on the free lists
+func (at *ArenaTable) DeleteIPNet(prefix *net.IPNet) error {
+	if err := checkFamily(at.ipBytesLen, prefix.IP, "delete"); err != nil {
+		return err
+	}
+	maskSize, _ := prefix.Mask.Size()
+	if maskSize == 0 {
+		if at.defaultEntry != 0 {
+			at.freeEntry(at.defaultEntry)
+			at.defaultEntry = 0
+		}
+		return nil
+	}
+
+	var path [net.IPv6len + 1]uint32
+	byteCount := (maskSize + 7) / 8
+	ipBytes := at.prefixBytes(prefix)
+	for i := 0; i < byteCount; i++ {
+		path[i+1] = at.child(path[i], ipBytes[i])
+		if path[i+1] == 0 {
+			return nil
+		}
+	}
+	node := &at.nodes[path[byteCount]]
+	entryIdx := (maskSize + 7) % 8
+	if node.entries[entryIdx] == 0 {
+		return nil
+	}
+	at.freeEntry(node.entries[entryIdx])
+	node.entries[entryIdx] = 0
+	node.entryCnt--
+
+	// free the nodes left empty
+	for i := byteCount; i > 0; i-- {
+		if node := &at.nodes[path[i]]; node.childCnt != 0 || node.entryCnt != 0 {
+			break
+		}
+		at.setChild(path[i-1], ipBytes[i-1], 0)
+		at.freeNodes = append(at.freeNodes, path[i])
+	}
+	return nil
+}
+
+// DeleteRange Delete the prefixes of the minimal cover of [start, end]
+func (at *ArenaTable) DeleteRange(start, end net.IP) error {
+	start, end, err := normalizeRange(start, end)
+	if err != nil {
+		return err
+	}
+	if err = checkFamily(at.ipBytesLen, start, "delete"); err != nil {
+		return err
+	}
+	prefixes, err := rangeToCIDRs(start, end)
+	if err != nil {
+		return err
+	}
+	for _, prefix := range prefixes {
+		if err = at.DeleteIPNet(prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (at *ArenaTable) Get(prefix string) *Entry {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil
+	}
+	return at.GetIPNet(ipNet)
+}
+
+// GetIPNet Return the entry of exactly prefix, without longest match
+func (at *ArenaTable) GetIPNet(prefix *net.IPNet) *Entry {
+	if checkFamily(at.ipBytesLen, prefix.IP, "get") != nil {
+		return nil
+	}
+	maskSize, _ := prefix.Mask.Size()
+	if maskSize == 0 {
+		return at.entry(at.defaultEntry)
+	}
+	ipBytes := at.prefixBytes(prefix)
+	node := uint32(0)
+	for i := 0; i < (maskSize+7)/8; i++ {
+		if node = at.child(node, ipBytes[i]); node == 0 {
+			return nil
+		}
+	}
+	return at.entry(at.nodes[node].entries[(maskSize+7)%8])
+}
+
+// lookupOneNode Return the longest entry of the children of node n
+// matching val and not excluding ip
+func (at *ArenaTable) lookupOneNode(n uint32, val byte, ip net.IP) uint32 {
+	preVal := val + 1
+	mask := byte(0xff)
+	for i := 0; i < 8; i++ {
+		val &= mask
+		mask <<= 1
+		if val == preVal {
+			continue
+		}
+		preVal = val
+		child := at.child(n, val)
+		if child == 0 {
+			continue
+		}
+		entries := &at.nodes[child].entries
+		for prefixMaskSize := 7 - i; prefixMaskSize >= 0; prefixMaskSize-- {
+			if e := entries[prefixMaskSize]; e != 0 && !at.excludes(e, ip) {
+				return e
+			}
+		}
+	}
+	return 0
+}
+
+// lookup Return the slot of the longest entry matching ip, 0 for none
+func (at *ArenaTable) lookup(ip net.IP) uint32 {
+	ipBytes := ip.To4()
+	if at.ipBytesLen == net.IPv6len {
+		if ipBytes != nil || len(ip) != net.IPv6len {
+			return 0
+		}
+		ipBytes = ip
+	} else if ipBytes == nil {
+		return 0
+	}
+
+	var path [net.IPv6len]uint32
+	depth := 0
+	for node := uint32(0); depth < len(ipBytes); depth++ {
+		path[depth] = node
+		if node = at.child(node, ipBytes[depth]); node == 0 {
+			depth++
+			break
+		}
+	}
+	for i := depth - 1; i >= 0; i-- {
+		if e := at.lookupOneNode(path[i], ipBytes[i], ip); e != 0 {
+			return e
+		}
+	}
+	if e := at.defaultEntry; e != 0 && !at.excludes(e, ip) {
+		return e
+	}
+	return 0
+}
+
+func (at *ArenaTable) Lookup(ip string) *Entry {
+	var buf [net.IPv6len]byte
+	ipp := parseIP(ip, &buf)
+	if ipp == nil {
+		return nil
+	}
+	return at.LookupIP(ipp)
+}
+
+// LookupIP Return the longest entry matching ip, built for the call with
+// one allocation. LookupValue does not allocate.
+func (at *ArenaTable) LookupIP(ip net.IP) *Entry {
+	return at.entry(at.lookup(ip))
+}
+
+// LookupValue Return the value of the longest entry matching ip, without
+// allocating
+func (at *ArenaTable) LookupValue(ip net.IP) (interface{}, bool) {
+	e := at.lookup(ip)
+	return at.values[e], e != 0
+}
+
+// SetFallback Set the table a throw route continues the lookup in, nil for
+// none. The fallback must not lead back to the table.
+func (at *ArenaTable) SetFallback(table LPMTable) {
+	at.fallback = table
+}
+
+func (at *ArenaTable) LookupRoute(ip string) LookupResult {
+	ipp := net.ParseIP(ip)
+	if ipp == nil {
+		return LookupResult{}
+	}
+	return at.LookupRouteIP(ipp)
+}
+
+// LookupRouteIP Return the longest match of ip with its route type, like
+// RadixTable.LookupRouteIP
+func (at *ArenaTable) LookupRouteIP(ip net.IP) LookupResult {
+	e := at.lookup(ip)
+	if e == 0 {
+		return LookupResult{}
+	}
+	typ := RouteType(at.entries[e].typ)
+	if typ == RouteThrow && at.fallback != nil {
+		return lookupRouteIP(at.fallback, ip)
+	}
+	return LookupResult{
+		Entry: at.entry(e),
+		Type:  typ,
+		Found: typ != RouteThrow,
+	}
+}
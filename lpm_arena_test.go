@@ -0,0 +1,230 @@
+package golpm
+
+import (
+	"math/rand"
+	"net"
+	"runtime"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestArenaTable(t *testing.T) {
+	Convey("Add, get and look entries up", t, func() {
+		table := NewArenaLPMTable(false).(*ArenaTable)
+		So(table.Add("0.0.0.0/0", "default"), ShouldBeNil)
+		So(table.Add("10.0.0.0/8", "a"), ShouldBeNil)
+		So(table.AddTyped("10.1.0.0/16", RouteBlackhole, "b"), ShouldBeNil)
+		So(table.AddExcept("10.2.0.0/16", []string{"10.2.3.0/24"}, "c"), ShouldBeNil)
+		So(table.AddRange(net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.6"), "d"), ShouldBeNil)
+		So(table.Add("2001:db8::/32", "v6"), ShouldBeError)
+
+		So(table.Lookup("10.9.9.9").Entry, ShouldEqual, "a")
+		So(table.Lookup("10.9.9.9").Prefix.String(), ShouldEqual, "10.0.0.0/8")
+		So(table.Lookup("10.1.1.1").Type, ShouldEqual, RouteBlackhole)
+		So(table.Lookup("10.2.4.1").Entry, ShouldEqual, "c")
+		So(table.Lookup("10.2.3.1").Entry, ShouldEqual, "a")
+		So(table.Lookup("192.0.2.4").Range.String(), ShouldEqual, "192.0.2.1-192.0.2.6")
+		So(table.Lookup("11.0.0.1").Entry, ShouldEqual, "default")
+		So(table.Lookup("2001:db8::1"), ShouldBeNil)
+		So(table.Get("10.2.0.0/16").Except[0].String(), ShouldEqual, "10.2.3.0/24")
+		So(table.Get("10.3.0.0/16"), ShouldBeNil)
+		So(table.LookupRoute("10.1.1.1").Deliverable(), ShouldBeFalse)
+
+		value, ok := table.LookupValue(net.ParseIP("10.9.9.9"))
+		So(ok, ShouldBeTrue)
+		So(value, ShouldEqual, "a")
+		So(len(table.Show()[32]), ShouldEqual, 2)
+
+		So(table.Delete("0.0.0.0/0"), ShouldBeNil)
+		So(table.Lookup("11.0.0.1"), ShouldBeNil)
+	})
+
+	Convey("Behave like a radix table", t, func() {
+		for _, isIPv6 := range []bool{false, true} {
+			bits := 32
+			if isIPv6 {
+				bits = 128
+			}
+			radix, arena := NewRadixLPMTable(isIPv6), NewArenaLPMTable(isIPv6)
+			rnd := rand.New(rand.NewSource(13))
+			randomIP := func() net.IP {
+				ip := make(net.IP, bits/8)
+				ip[0], ip[1], ip[2], ip[3] = 10, byte(rnd.Intn(4)), byte(rnd.Intn(256)), byte(rnd.Intn(256))
+				return ip
+			}
+			for round := 0; round < 3000; round++ {
+				maskLen := rnd.Intn(33)
+				if isIPv6 && maskLen > 30 {
+					maskLen = bits - rnd.Intn(3)
+				}
+				prefix := &net.IPNet{IP: randomIP().Mask(net.CIDRMask(maskLen, bits)), Mask: net.CIDRMask(maskLen, bits)}
+				if rnd.Intn(3) == 0 {
+					So(radix.DeleteIPNet(prefix), ShouldBeNil)
+					So(arena.DeleteIPNet(prefix), ShouldBeNil)
+				} else {
+					So(radix.AddIPNet(prefix, round), ShouldBeNil)
+					So(arena.AddIPNet(prefix, round), ShouldBeNil)
+				}
+			}
+
+			So(arena.Show(), ShouldResemble, radix.Show())
+			So(Diff(radix, arena, nil), ShouldResemble, &TableDiff{})
+			for i := 0; i < 5000; i++ {
+				ip := randomIP()
+				want, got := radix.LookupIP(ip), arena.LookupIP(ip)
+				if want == nil {
+					So(got, ShouldBeNil)
+				} else {
+					So(got, ShouldResemble, want)
+				}
+			}
+
+			for _, entries := range radix.Show() {
+				for _, entry := range entries {
+					So(arena.(PrefixGetter).GetIPNet(entry.Prefix), ShouldResemble, &entry)
+					So(arena.DeleteIPNet(entry.Prefix), ShouldBeNil)
+				}
+			}
+			at := arena.(*ArenaTable)
+			So(at.Len(), ShouldEqual, 0)
+			So(at.nodes[0].childCnt, ShouldEqual, 0)
+			So(len(at.freeNodes), ShouldEqual, len(at.nodes)-1)
+		}
+	})
+
+	Convey("Reuse freed nodes, entries and blocks", t, func() {
+		table := NewArenaLPMTable(false).(*ArenaTable)
+		add := func() {
+			for i := 0; i < 300; i++ {
+				table.AddIPNet(&net.IPNet{IP: net.IPv4(10, byte(i), byte(i>>8), 0).To4(), Mask: net.CIDRMask(24, 32)}, i)
+			}
+		}
+		add()
+		nodes, entries, slots := len(table.nodes), len(table.entries), len(table.slots)
+		for round := 0; round < 3; round++ {
+			for i := 0; i < 300; i++ {
+				table.DeleteIPNet(&net.IPNet{IP: net.IPv4(10, byte(i), byte(i>>8), 0).To4(), Mask: net.CIDRMask(24, 32)})
+			}
+			So(table.Len(), ShouldEqual, 0)
+			add()
+			So(len(table.nodes), ShouldEqual, nodes)
+			So(len(table.entries), ShouldEqual, entries)
+			So(len(table.slots), ShouldEqual, slots)
+		}
+		So(table.Lookup("10.255.0.1").Entry, ShouldEqual, 255)
+		So(table.Lookup("10.43.1.1").Entry, ShouldEqual, 299)
+	})
+
+	Convey("Keep the children of a node like a map", t, func() {
+		rnd := rand.New(rand.NewSource(17))
+		table := NewArenaLPMTable(false).(*ArenaTable)
+		children := make(map[byte]uint32)
+		for round := 0; round < 20000; round++ {
+			idx := byte(rnd.Intn(256))
+			// sweep the count up and down through every class
+			if rnd.Intn(2000) < round%2000 {
+				delete(children, idx)
+				table.setChild(0, idx, 0)
+			} else {
+				child := uint32(rnd.Intn(1000) + 1)
+				children[idx] = child
+				table.setChild(0, idx, child)
+			}
+			So(int(table.nodes[0].childCnt), ShouldEqual, len(children))
+			if round%50 == 0 {
+				var want []uint32
+				for idx := 0; idx < 256; idx++ {
+					So(table.child(0, byte(idx)), ShouldEqual, children[byte(idx)])
+					if c := children[byte(idx)]; c != 0 {
+						want = append(want, c)
+					}
+				}
+				So(table.children(0, nil), ShouldResemble, want)
+			}
+		}
+	})
+
+	Convey("Look values up without allocating", t, func() {
+		table := NewArenaLPMTable(true).(*ArenaTable)
+		table.Add("2001:db8::/32", "a")
+		ip := net.ParseIP("2001:db8::1")
+		So(testing.AllocsPerRun(100, func() { table.LookupValue(ip) }), ShouldEqual, 0)
+
+		// entries are built for each lookup, in one allocation
+		So(testing.AllocsPerRun(100, func() { table.LookupIP(ip) }), ShouldEqual, 1)
+		So(testing.AllocsPerRun(100, func() { table.Lookup("2001:db8::1") }), ShouldEqual, 1)
+		first, second := table.LookupIP(ip), table.LookupIP(ip)
+		So(first, ShouldNotPointTo, second)
+		So(first, ShouldResemble, second)
+		So(first.Prefix.String(), ShouldEqual, "2001:db8::/32")
+	})
+
+	Convey("Create dual tables of the arena arch", t, func() {
+		table := NewDualLPMTable(ArchArena)
+		table.Add("10.0.0.0/8", "a")
+		table.Add("2001:db8::/32", "b")
+		So(table.Lookup("10.0.0.1").Entry, ShouldEqual, "a")
+		So(table.Lookup("2001:db8::1").Entry, ShouldEqual, "b")
+	})
+}
+
+func benchmarkGC(b *testing.B, table LPMTable) {
+	rnd := rand.New(rand.NewSource(17))
+	ip := make(net.IP, net.IPv4len)
+	for i := 0; i < 1000000; i++ {
+		rnd.Read(ip)
+		maskLen := 16 + rnd.Intn(17)
+		table.AddIPNet(&net.IPNet{IP: ip.Mask(net.CIDRMask(maskLen, 32)), Mask: net.CIDRMask(maskLen, 32)}, "next hop")
+	}
+	runtime.GC()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(b.N)/1e3, "us-pause/gc")
+	runtime.KeepAlive(table)
+}
+
+// BenchmarkArenaTable_Lookup Compare LookupValue, which does not allocate,
+// with LookupIP, which allocates the Entry it returns on every call
+func BenchmarkArenaTable_Lookup(b *testing.B) {
+	rnd := rand.New(rand.NewSource(9))
+	table := NewArenaLPMTable(false).(*ArenaTable)
+	ips := make([]net.IP, 10000)
+	for i := range ips {
+		ip := make(net.IP, net.IPv4len)
+		rnd.Read(ip)
+		maskLen := 8 + rnd.Intn(25)
+		table.AddIPNet(&net.IPNet{IP: ip.Mask(net.CIDRMask(maskLen, 32)), Mask: net.CIDRMask(maskLen, 32)}, i)
+		ips[i] = ip
+	}
+
+	b.Run("LookupValue", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			table.LookupValue(ips[i%len(ips)])
+		}
+	})
+	b.Run("LookupIP", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			table.LookupIP(ips[i%len(ips)])
+		}
+	})
+}
+
+// BenchmarkGC_1M Time a full collection with a 1M prefix table alive
+func BenchmarkGC_1M(b *testing.B) {
+	b.Run("Radix", func(b *testing.B) {
+		benchmarkGC(b, NewRadixLPMTable(false))
+	})
+	b.Run("Arena", func(b *testing.B) {
+		benchmarkGC(b, NewArenaLPMTable(false))
+	})
+}
@@ -0,0 +1,155 @@
+package golpm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ASNInfo Origin information of a prefix.
+// Each origin is a single AS or, for an AS set, all of its members.
+type ASNInfo struct {
+	Origins     [][]uint32
+	Country     string
+	Description string
+}
+
+// ASNs Return the distinct AS numbers of all origins
+func (ai *ASNInfo) ASNs() []uint32 {
+	var asns []uint32
+	seen := make(map[uint32]bool)
+	for _, origin := range ai.Origins {
+		for _, asn := range origin {
+			if !seen[asn] {
+				seen[asn] = true
+				asns = append(asns, asn)
+			}
+		}
+	}
+	return asns
+}
+
+// ASNTable A dual-family lpm table mapping prefixes to origin AS numbers
+type ASNTable struct {
+	table *DualTable
+}
+
+// NewASNTable Create an empty ASN table
+func NewASNTable() *ASNTable {
+	return &ASNTable{
+		table: NewDualLPMTable(ArchRadix),
+	}
+}
+
+// Table Return the underlying lpm table, entries are *ASNInfo. Lookups
+// ignore entries of other types added through it.
+func (at *ASNTable) Table() LPMTable {
+	return at.table
+}
+
+func (at *ASNTable) Lookup(ip string) *ASNInfo {
+	ipp := net.ParseIP(ip)
+	if ipp == nil {
+		return nil
+	}
+	return at.LookupIP(ipp)
+}
+
+func (at *ASNTable) LookupIP(ip net.IP) *ASNInfo {
+	entry := at.table.LookupIP(ip)
+	if entry == nil {
+		return nil
+	}
+	info, _ := entry.Entry.(*ASNInfo)
+	return info
+}
+
+func parseASOrigins(field string) ([][]uint32, error) {
+	var origins [][]uint32
+	// "_" separates the origins of a multi-origin prefix, "," the members of an AS set
+	for _, moas := range strings.Split(field, "_") {
+		var origin []uint32
+		for _, member := range strings.Split(moas, ",") {
+			asn, err := strconv.ParseUint(member, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			origin = append(origin, uint32(asn))
+		}
+		origins = append(origins, origin)
+	}
+	return origins, nil
+}
+
+func scanLines(r io.Reader, fn func(line string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// LoadPfx2as Load a CAIDA routeviews prefix-to-AS file, whose lines are
+// "prefix<TAB>length<TAB>origins" with multi-origin ASes separated by "_"
+// and AS set members by ",".
+func (at *ASNTable) LoadPfx2as(r io.Reader) error {
+	return scanLines(r, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return fmt.Errorf("expect 3 fields, got %d", len(fields))
+		}
+		_, prefix, err := net.ParseCIDR(fields[0] + "/" + fields[1])
+		if err != nil {
+			return err
+		}
+		origins, err := parseASOrigins(fields[2])
+		if err != nil {
+			return err
+		}
+		return at.table.AddIPNet(prefix, &ASNInfo{Origins: origins})
+	})
+}
+
+// LoadIPToASN Load an iptoasn range file, whose lines are
+// "start<TAB>end<TAB>asn<TAB>country<TAB>description".
+// Ranges are split into prefixes and ranges of AS 0 (not routed) are skipped.
+func (at *ASNTable) LoadIPToASN(r io.Reader) error {
+	return scanLines(r, func(line string) error {
+		fields := strings.SplitN(line, "\t", 5)
+		if len(fields) < 3 {
+			return fmt.Errorf("expect at least 3 fields, got %d", len(fields))
+		}
+		start, end := net.ParseIP(fields[0]), net.ParseIP(fields[1])
+		if start == nil || end == nil {
+			return fmt.Errorf("invalid range %s-%s", fields[0], fields[1])
+		}
+		asn, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return err
+		}
+		if asn == 0 {
+			return nil
+		}
+		info := &ASNInfo{
+			Origins: [][]uint32{{uint32(asn)}},
+		}
+		if len(fields) > 3 && fields[3] != "None" {
+			info.Country = fields[3]
+		}
+		if len(fields) > 4 && fields[4] != "Not routed" {
+			info.Description = fields[4]
+		}
+
+		return at.table.AddRange(start, end, info)
+	})
+}
@@ -0,0 +1,91 @@
+package golpm
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestASNTable_LoadPfx2as(t *testing.T) {
+	Convey("Load a pfx2as file", t, func() {
+		table := NewASNTable()
+		err := table.LoadPfx2as(strings.NewReader(strings.Join([]string{
+			"# comment",
+			"1.0.0.0\t24\t13335",
+			"1.0.4.0\t22\t38803_56203",
+			"1.0.8.0\t21\t4134,4809",
+			"1.0.16.0\t20\t1_2,3",
+			"2001:db8::\t32\t64512",
+			"",
+		}, "\n")))
+		So(err, ShouldBeNil)
+
+		So(table.Lookup("1.0.0.1").Origins, ShouldResemble, [][]uint32{{13335}})
+		So(table.Lookup("1.0.5.1").Origins, ShouldResemble, [][]uint32{{38803}, {56203}})
+		So(table.Lookup("1.0.9.1").Origins, ShouldResemble, [][]uint32{{4134, 4809}})
+		info := table.Lookup("1.0.17.1")
+		So(info.Origins, ShouldResemble, [][]uint32{{1}, {2, 3}})
+		So(info.ASNs(), ShouldResemble, []uint32{1, 2, 3})
+		So(table.Lookup("2001:db8::1").ASNs(), ShouldResemble, []uint32{64512})
+		So(table.Lookup("1.0.1.1"), ShouldBeNil)
+		So(table.Lookup("bad ip"), ShouldBeNil)
+
+		// entries of other types added through Table are ignored
+		So(table.Table().Add("1.0.1.0/24", "not an ASNInfo"), ShouldBeNil)
+		So(table.Lookup("1.0.1.1"), ShouldBeNil)
+	})
+
+	Convey("Load a malformed pfx2as file", t, func() {
+		table := NewASNTable()
+		err := table.LoadPfx2as(strings.NewReader("1.0.0.0\t24\n"))
+		So(err, ShouldBeError)
+		err = table.LoadPfx2as(strings.NewReader("1.0.0.0\t24\tAS1\n"))
+		So(err, ShouldBeError)
+		err = table.LoadPfx2as(strings.NewReader("1.0.0.0\t33\t1\n"))
+		So(err, ShouldBeError)
+	})
+}
+
+func TestASNTable_LoadIPToASN(t *testing.T) {
+	Convey("Load an iptoasn file", t, func() {
+		table := NewASNTable()
+		err := table.LoadIPToASN(strings.NewReader(strings.Join([]string{
+			"1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET",
+			"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed",
+			"1.2.3.7\t1.2.4.10\t64512\tDE\tEXAMPLE AS\twith a tab",
+			"2001:db8::\t2001:db8::1:ffff\t64513\tNone\tV6NET",
+		}, "\n")))
+		So(err, ShouldBeNil)
+
+		info := table.Lookup("1.0.0.1")
+		So(info.ASNs(), ShouldResemble, []uint32{13335})
+		So(info.Country, ShouldEqual, "US")
+		So(info.Description, ShouldEqual, "CLOUDFLARENET")
+		So(table.Lookup("1.0.2.1"), ShouldBeNil)
+
+		for _, ip := range []string{"1.2.3.7", "1.2.3.200", "1.2.4.10"} {
+			info = table.Lookup(ip)
+			So(info, ShouldNotBeNil)
+			So(info.Description, ShouldEqual, "EXAMPLE AS\twith a tab")
+		}
+		So(table.Lookup("1.2.3.6"), ShouldBeNil)
+		So(table.Lookup("1.2.4.11"), ShouldBeNil)
+
+		info = table.Lookup("2001:db8::1:1")
+		So(info.ASNs(), ShouldResemble, []uint32{64513})
+		So(info.Country, ShouldEqual, "")
+		So(table.Lookup("2001:db8::2:0"), ShouldBeNil)
+		So(len(table.Table().Show()[111]), ShouldEqual, 1)
+	})
+
+	Convey("Load a malformed iptoasn file", t, func() {
+		table := NewASNTable()
+		err := table.LoadIPToASN(strings.NewReader("1.0.0.0\t1.0.0.255\n"))
+		So(err, ShouldBeError)
+		err = table.LoadIPToASN(strings.NewReader("1.0.0.9\t1.0.0.1\t1\n"))
+		So(err, ShouldBeError)
+		err = table.LoadIPToASN(strings.NewReader("1.0.0.0\tfoo\t1\n"))
+		So(err, ShouldBeError)
+	})
+}
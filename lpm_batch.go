@@ -0,0 +1,124 @@
+package golpm
+
+import (
+	"net"
+	"net/netip"
+)
+
+// batchBlockSize The number of addresses walked down the tree side by side
+const batchBlockSize = 8
+
+// batchKey An address in the byte form the table is indexed with
+type batchKey struct {
+	bytes [net.IPv6len]byte
+	n     int // 0 when the address cannot match
+}
+
+// setKey Set key to the bytes LookupIP uses for ip
+func (rt *RadixTable) setKey(key *batchKey, ip net.IP) {
+	key.n = 0
+	switch rt.ipBytesLen {
+	case net.IPv4len:
+		if ip4 := ip.To4(); ip4 != nil {
+			key.n = copy(key.bytes[:], ip4)
+		}
+	case net.IPv6len:
+		if ip.To4() == nil && len(ip) == net.IPv6len {
+			key.n = copy(key.bytes[:], ip)
+		}
+	default:
+		key.n = copy(key.bytes[:], ip)
+	}
+}
+
+// LookupBatch Store in out[i] the result of LookupIP for ips[i]. out must
+// be at least as long as ips. Addresses are walked down the tree by blocks,
+// a level at a time, so that the memory accesses of the addresses of a
+// block overlap; no memory is allocated.
+func (rt *RadixTable) LookupBatch(ips []netip.Addr, out []*Entry) {
+	_ = out[:len(ips)]
+	var keys [batchBlockSize]batchKey
+	for start := 0; start < len(ips); start += batchBlockSize {
+		block := ips[start:]
+		if len(block) > batchBlockSize {
+			block = block[:batchBlockSize]
+		}
+		for j, addr := range block {
+			if addr.Is4() {
+				a := addr.As4()
+				rt.setKey(&keys[j], a[:])
+			} else if addr.IsValid() {
+				a := addr.As16()
+				rt.setKey(&keys[j], a[:])
+			} else {
+				keys[j].n = 0
+			}
+		}
+		rt.lookupBlock(keys[:len(block)], out[start:start+len(block)])
+	}
+}
+
+// LookupBatchIP Like LookupBatch, for net.IP addresses
+func (rt *RadixTable) LookupBatchIP(ips []net.IP, out []*Entry) {
+	_ = out[:len(ips)]
+	var keys [batchBlockSize]batchKey
+	for start := 0; start < len(ips); start += batchBlockSize {
+		block := ips[start:]
+		if len(block) > batchBlockSize {
+			block = block[:batchBlockSize]
+		}
+		for j, ip := range block {
+			rt.setKey(&keys[j], ip)
+		}
+		rt.lookupBlock(keys[:len(block)], out[start:start+len(block)])
+	}
+}
+
+// lookupBlock Look the keys up with the results of LookupIP: walk down
+// the nodes of each key, keeping the longest match found so far. The keys
+// walk down side by side, a level at a time, so that their cache misses
+// overlap instead of following each other.
+func (rt *RadixTable) lookupBlock(keys []batchKey, out []*Entry) {
+	var nodes [batchBlockSize]*radixNode
+	active := 0
+	for j := range keys {
+		out[j], nodes[j] = nil, nil
+		if keys[j].n > 0 && rt.root != nil {
+			nodes[j] = rt.root
+			active++
+		}
+	}
+
+	for depth := 0; active > 0; depth++ {
+		level := rt.level(depth)
+		for j, node := range nodes[:len(keys)] {
+			if node == nil {
+				continue
+			}
+			key := &keys[j]
+			if level.offset >= key.n*8 {
+				nodes[j] = nil
+				active--
+				continue
+			}
+			idx := level.index(key.bytes[:key.n])
+			if entry := node.lookupOneNode(idx, net.IP(key.bytes[:key.n]), nil); entry != nil {
+				out[j] = entry
+			}
+			if nodes[j] = node.child(idx); nodes[j] == nil {
+				active--
+			}
+		}
+	}
+
+	for j := range keys {
+		key := &keys[j]
+		if key.n == 0 || out[j] != nil {
+			continue
+		}
+		ip := net.IP(key.bytes[:key.n])
+		if entry := rt.defaultEntry; entry != nil && (entry.Except == nil || !entry.excludes(ip)) {
+			out[j] = entry
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package golpm
+
+import (
+	"math/rand"
+	"net"
+	"net/netip"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// randomBenchTable Return a table of n random ipv4 prefixes and addresses
+// inside them
+func randomBenchTable(rnd *rand.Rand, n int) (*RadixTable, []net.IP) {
+	table := NewRadixLPMTable(false).(*RadixTable)
+	ips := make([]net.IP, 0, n)
+	for i := 0; i < n; i++ {
+		maskLen := 8 + rnd.Intn(25)
+		ip := net.IPv4(byte(rnd.Intn(224)), byte(rnd.Intn(256)), byte(rnd.Intn(256)), byte(rnd.Intn(256))).To4()
+		table.AddIPNet(&net.IPNet{IP: ip.Mask(net.CIDRMask(maskLen, 32)), Mask: net.CIDRMask(maskLen, 32)}, i)
+		ips = append(ips, ip)
+	}
+	rnd.Shuffle(len(ips), func(i, j int) { ips[i], ips[j] = ips[j], ips[i] })
+	return table, ips
+}
+
+func TestRadixTable_LookupBatch(t *testing.T) {
+	Convey("Match LookupIP for every address", t, func() {
+		rnd := rand.New(rand.NewSource(6))
+		for _, isIPv6 := range []bool{false, true} {
+			table := NewRadixLPMTable(isIPv6).(*RadixTable)
+			randomIP := func() net.IP {
+				if isIPv6 {
+					return net.IP{0x20, 0x01, 0x0d, 0xb8, byte(rnd.Intn(4)), byte(rnd.Intn(256)), 0, 0, 0, 0, 0, 0, 0, 0, 0, byte(rnd.Intn(256))}
+				}
+				return net.IPv4(10, byte(rnd.Intn(4)), byte(rnd.Intn(256)), byte(rnd.Intn(256)))
+			}
+			bits := 32
+			if isIPv6 {
+				bits = 128
+			}
+			for i := 0; i < 200; i++ {
+				maskLen := rnd.Intn(bits + 1)
+				prefix := &net.IPNet{IP: randomIP().Mask(net.CIDRMask(maskLen, bits)), Mask: net.CIDRMask(maskLen, bits)}
+				var except []*net.IPNet
+				if rnd.Intn(5) == 0 && maskLen < bits {
+					except = append(except, &net.IPNet{IP: prefix.IP, Mask: net.CIDRMask(maskLen+1, bits)})
+				}
+				So(table.AddIPNetExcept(prefix, except, i), ShouldBeNil)
+			}
+
+			ips := make([]net.IP, 1000)
+			addrs := make([]netip.Addr, len(ips))
+			for i := range ips {
+				ips[i] = randomIP()
+				addrs[i], _ = netip.AddrFromSlice(ips[i])
+			}
+			// addresses of the other family and invalid ones never match
+			ips[7] = net.ParseIP("2001:db8::1")
+			ips[8] = net.ParseIP("192.0.2.1")
+			addrs[7], addrs[8], addrs[9] = netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("::ffff:192.0.2.1"), netip.Addr{}
+
+			out := make([]*Entry, len(ips))
+			table.LookupBatchIP(ips, out)
+			for i, ip := range ips {
+				So(out[i], ShouldEqual, table.LookupIP(ip))
+			}
+			table.LookupBatch(addrs, out)
+			for i, addr := range addrs {
+				if !addr.IsValid() {
+					So(out[i], ShouldBeNil)
+					continue
+				}
+				So(out[i], ShouldEqual, table.LookupIP(net.IP(addr.AsSlice())))
+			}
+		}
+	})
+
+	Convey("Allocate nothing", t, func() {
+		table, ips := randomBenchTable(rand.New(rand.NewSource(7)), 1000)
+		addrs := make([]netip.Addr, len(ips))
+		for i, ip := range ips {
+			addrs[i], _ = netip.AddrFromSlice(ip)
+		}
+		out := make([]*Entry, len(ips))
+		So(testing.AllocsPerRun(10, func() { table.LookupBatch(addrs, out) }), ShouldEqual, 0)
+		So(testing.AllocsPerRun(10, func() { table.LookupBatchIP(ips, out) }), ShouldEqual, 0)
+	})
+}
+
+func BenchmarkRadixTable_LookupBatch(b *testing.B) {
+	table, ips := randomBenchTable(rand.New(rand.NewSource(8)), 100000)
+	addrs := make([]netip.Addr, len(ips))
+	for i, ip := range ips {
+		addrs[i], _ = netip.AddrFromSlice(ip)
+	}
+	out := make([]*Entry, len(ips))
+
+	b.Run("LookupIP", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ip := ips[i%len(ips)]
+			out[i%len(ips)] = table.LookupIP(ip)
+		}
+	})
+	b.Run("LookupBatchIP", func(b *testing.B) {
+		for i := 0; i < b.N; i += len(ips) {
+			n := len(ips)
+			if b.N-i < n {
+				n = b.N - i
+			}
+			table.LookupBatchIP(ips[:n], out)
+		}
+	})
+	b.Run("LookupBatch", func(b *testing.B) {
+		for i := 0; i < b.N; i += len(addrs) {
+			n := len(addrs)
+			if b.N-i < n {
+				n = b.N - i
+			}
+			table.LookupBatch(addrs[:n], out)
+		}
+	})
+}
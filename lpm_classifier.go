@@ -0,0 +1,230 @@
+package golpm
+
+import (
+	"errors"
+	"math/bits"
+	"net"
+	"sort"
+)
+
+// PortRange An inclusive range of ports. The zero value matches any port.
+type PortRange struct {
+	Min uint16
+	Max uint16
+}
+
+func (pr PortRange) any() bool {
+	return pr.Min == 0 && pr.Max == 0
+}
+
+func (pr PortRange) contains(port uint16) bool {
+	return pr.any() || pr.Min <= port && port <= pr.Max
+}
+
+// FiveTuple The fields of a packet a classifier matches on
+type FiveTuple struct {
+	Src     net.IP
+	Dst     net.IP
+	Proto   uint8
+	SrcPort uint16
+	DstPort uint16
+}
+
+// ClassRule A classifier rule. Nil prefixes, zero port ranges and a zero
+// protocol match any value. Rules of lower priority value are preferred,
+// then rules given first.
+type ClassRule struct {
+	Priority int
+	Src      *net.IPNet
+	Dst      *net.IPNet
+	SrcPorts PortRange
+	DstPorts PortRange
+	Proto    uint8
+	Value    interface{}
+}
+
+// Matches Report whether pkt matches the rule
+func (r *ClassRule) Matches(pkt FiveTuple) bool {
+	return (r.Src == nil || r.Src.Contains(pkt.Src)) &&
+		(r.Dst == nil || r.Dst.Contains(pkt.Dst)) &&
+		r.SrcPorts.contains(pkt.SrcPort) &&
+		r.DstPorts.contains(pkt.DstPort) &&
+		(r.Proto == 0 || r.Proto == pkt.Proto)
+}
+
+// ClassifyLinear Return the preferred rule of rules matching pkt, checking
+// every rule. It is the reference implementation of Classifier.
+func ClassifyLinear(rules []ClassRule, pkt FiveTuple) *ClassRule {
+	var best *ClassRule
+	for i := range rules {
+		if rules[i].Matches(pkt) && (best == nil || rules[i].Priority < best.Priority) {
+			best = &rules[i]
+		}
+	}
+	return best
+}
+
+// ruleBits A set of rules, by index in priority order
+type ruleBits []uint64
+
+func newRuleBits(n int) ruleBits {
+	return make(ruleBits, (n+63)/64)
+}
+
+func (rb ruleBits) set(i int) {
+	rb[i/64] |= 1 << (i % 64)
+}
+
+// portIndex The sets of rules matching each elementary port interval
+type portIndex struct {
+	starts []uint16 // first port of each interval, starting at 0
+	sets   []ruleBits
+}
+
+func (pi *portIndex) lookup(port uint16) ruleBits {
+	i := sort.Search(len(pi.starts), func(i int) bool {
+		return pi.starts[i] > port
+	})
+	return pi.sets[i-1]
+}
+
+func newPortIndex(rules []*ClassRule, ports func(r *ClassRule) PortRange) portIndex {
+	bounds := map[uint16]bool{0: true}
+	for _, r := range rules {
+		pr := ports(r)
+		if pr.any() {
+			continue
+		}
+		bounds[pr.Min] = true
+		if pr.Max < 65535 {
+			bounds[pr.Max+1] = true
+		}
+	}
+	var pi portIndex
+	for start := range bounds {
+		pi.starts = append(pi.starts, start)
+	}
+	sort.Slice(pi.starts, func(i, j int) bool { return pi.starts[i] < pi.starts[j] })
+
+	for _, start := range pi.starts {
+		set := newRuleBits(len(rules))
+		for i, r := range rules {
+			if ports(r).contains(start) {
+				set.set(i)
+			}
+		}
+		pi.sets = append(pi.sets, set)
+	}
+	return pi
+}
+
+// prefixIndex The sets of rules matching addresses, by longest rule prefix
+type prefixIndex struct {
+	table *DualTable // entries are ruleBits
+	any   ruleBits   // rules matching any address
+}
+
+func (pi *prefixIndex) lookup(ip net.IP) ruleBits {
+	if entry := pi.table.LookupIP(ip); entry != nil {
+		return entry.Entry.(ruleBits)
+	}
+	return pi.any
+}
+
+func newPrefixIndex(rules []*ClassRule, prefix func(r *ClassRule) *net.IPNet) (prefixIndex, error) {
+	pi := prefixIndex{
+		table: NewDualLPMTable(ArchRadix),
+		any:   newRuleBits(len(rules)),
+	}
+	for i, r := range rules {
+		if prefix(r) == nil {
+			pi.any.set(i)
+		}
+	}
+	// an address matches the rules of its longest rule prefix and of
+	// every shorter prefix containing it
+	for _, r := range rules {
+		p := prefix(r)
+		if p == nil || pi.table.GetIPNet(p) != nil {
+			continue
+		}
+		set := append(ruleBits(nil), pi.any...)
+		for i, other := range rules {
+			if q := prefix(other); q != nil && prefixCovers(q, p) {
+				set.set(i)
+			}
+		}
+		if err := pi.table.AddIPNet(p, set); err != nil {
+			return pi, err
+		}
+	}
+	return pi, nil
+}
+
+// Classifier A packet classifier compiled from rules. Each field is looked
+// up in its own structure, giving the set of rules matching the field as a
+// bit vector; the preferred rule is the first one in all five sets.
+type Classifier struct {
+	rules    []*ClassRule // in priority order
+	src      prefixIndex
+	dst      prefixIndex
+	srcPorts portIndex
+	dstPorts portIndex
+	protos   [256]ruleBits
+}
+
+// NewClassifier Compile rules into a classifier. Later changes to rules do
+// not affect it.
+func NewClassifier(rules []ClassRule) (*Classifier, error) {
+	c := &Classifier{}
+	for i := range rules {
+		r := rules[i]
+		if r.SrcPorts.Min > r.SrcPorts.Max || r.DstPorts.Min > r.DstPorts.Max {
+			return nil, errors.New("port range minimum above maximum")
+		}
+		for _, p := range []**net.IPNet{&r.Src, &r.Dst} {
+			if *p != nil {
+				*p = &net.IPNet{IP: (*p).IP.Mask((*p).Mask), Mask: (*p).Mask}
+			}
+		}
+		c.rules = append(c.rules, &r)
+	}
+	sort.SliceStable(c.rules, func(i, j int) bool {
+		return c.rules[i].Priority < c.rules[j].Priority
+	})
+
+	var err error
+	if c.src, err = newPrefixIndex(c.rules, func(r *ClassRule) *net.IPNet { return r.Src }); err != nil {
+		return nil, err
+	}
+	if c.dst, err = newPrefixIndex(c.rules, func(r *ClassRule) *net.IPNet { return r.Dst }); err != nil {
+		return nil, err
+	}
+	c.srcPorts = newPortIndex(c.rules, func(r *ClassRule) PortRange { return r.SrcPorts })
+	c.dstPorts = newPortIndex(c.rules, func(r *ClassRule) PortRange { return r.DstPorts })
+	for proto := range c.protos {
+		set := newRuleBits(len(c.rules))
+		for i, r := range c.rules {
+			if r.Proto == 0 || int(r.Proto) == proto {
+				set.set(i)
+			}
+		}
+		c.protos[proto] = set
+	}
+	return c, nil
+}
+
+// Classify Return the preferred rule matching pkt, or nil
+func (c *Classifier) Classify(pkt FiveTuple) *ClassRule {
+	src := c.src.lookup(pkt.Src)
+	dst := c.dst.lookup(pkt.Dst)
+	srcPorts := c.srcPorts.lookup(pkt.SrcPort)
+	dstPorts := c.dstPorts.lookup(pkt.DstPort)
+	protos := c.protos[pkt.Proto]
+	for w := range src {
+		if word := src[w] & dst[w] & srcPorts[w] & dstPorts[w] & protos[w]; word != 0 {
+			return c.rules[w*64+bits.TrailingZeros64(word)]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package golpm
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClassifier(t *testing.T) {
+	Convey("Classify packets with a rule set", t, func() {
+		rules := []ClassRule{
+			{Priority: 10, Src: mustCIDR("10.0.0.0/8"), Dst: mustCIDR("192.0.2.0/24"), DstPorts: PortRange{443, 443}, Proto: 6, Value: "https"},
+			{Priority: 20, Src: mustCIDR("10.1.0.0/16"), Proto: 17, DstPorts: PortRange{53, 53}, Value: "dns"},
+			{Priority: 30, Dst: mustCIDR("192.0.2.0/24"), SrcPorts: PortRange{1024, 65535}, Value: "high ports"},
+			{Priority: 40, Src: mustCIDR("2001:db8::/32"), Value: "v6"},
+			{Priority: 5, Src: mustCIDR("10.66.0.0/16"), Value: "blocked"},
+			{Priority: 100, Value: "default"},
+		}
+		c, err := NewClassifier(rules)
+		So(err, ShouldBeNil)
+
+		pkt := func(src, dst string, proto uint8, srcPort, dstPort uint16) FiveTuple {
+			return FiveTuple{Src: net.ParseIP(src), Dst: net.ParseIP(dst), Proto: proto, SrcPort: srcPort, DstPort: dstPort}
+		}
+		for _, tc := range []struct {
+			pkt  FiveTuple
+			want string
+		}{
+			{pkt("10.1.2.3", "192.0.2.10", 6, 40000, 443), "https"},
+			{pkt("10.1.2.3", "198.51.100.1", 17, 40000, 53), "dns"},
+			{pkt("10.1.2.3", "192.0.2.10", 17, 40000, 443), "high ports"},
+			{pkt("10.1.2.3", "192.0.2.10", 17, 1000, 443), "default"},
+			{pkt("10.66.2.3", "192.0.2.10", 6, 40000, 443), "blocked"},
+			{pkt("2001:db8::1", "2001:db8::2", 6, 1, 2), "v6"},
+			{pkt("2001:db9::1", "192.0.2.10", 6, 1, 2), "default"},
+		} {
+			So(c.Classify(tc.pkt).Value, ShouldEqual, tc.want)
+			So(ClassifyLinear(rules, tc.pkt).Value, ShouldEqual, tc.want)
+		}
+
+		empty, err := NewClassifier(nil)
+		So(err, ShouldBeNil)
+		So(empty.Classify(pkt("10.0.0.1", "10.0.0.2", 6, 1, 2)), ShouldBeNil)
+
+		_, err = NewClassifier([]ClassRule{{DstPorts: PortRange{10, 5}}})
+		So(err, ShouldBeError)
+	})
+
+	Convey("Agree with the linear classifier on random rules", t, func() {
+		rnd := rand.New(rand.NewSource(4))
+		randomPrefix := func() *net.IPNet {
+			if rnd.Intn(4) == 0 {
+				return nil
+			}
+			maskLen := 8 + rnd.Intn(25)
+			ip := net.IPv4(10, byte(rnd.Intn(4)), byte(rnd.Intn(4)), byte(rnd.Intn(256)))
+			return &net.IPNet{IP: ip.Mask(net.CIDRMask(maskLen, 32)), Mask: net.CIDRMask(maskLen, 32)}
+		}
+		randomPorts := func() PortRange {
+			if rnd.Intn(3) == 0 {
+				return PortRange{}
+			}
+			min := uint16(rnd.Intn(100))
+			return PortRange{min, min + uint16(rnd.Intn(50))}
+		}
+
+		for round := 0; round < 10; round++ {
+			rules := make([]ClassRule, 100)
+			for i := range rules {
+				rules[i] = ClassRule{
+					Priority: rnd.Intn(20),
+					Src:      randomPrefix(),
+					Dst:      randomPrefix(),
+					SrcPorts: randomPorts(),
+					DstPorts: randomPorts(),
+					Proto:    []uint8{0, 6, 17}[rnd.Intn(3)],
+					Value:    i,
+				}
+			}
+			c, err := NewClassifier(rules)
+			So(err, ShouldBeNil)
+
+			for i := 0; i < 2000; i++ {
+				p := FiveTuple{
+					Src:     net.IPv4(10, byte(rnd.Intn(4)), byte(rnd.Intn(4)), byte(rnd.Intn(256))),
+					Dst:     net.IPv4(10, byte(rnd.Intn(4)), byte(rnd.Intn(4)), byte(rnd.Intn(256))),
+					Proto:   []uint8{1, 6, 17}[rnd.Intn(3)],
+					SrcPort: uint16(rnd.Intn(160)),
+					DstPort: uint16(rnd.Intn(160)),
+				}
+				want := ClassifyLinear(rules, p)
+				got := c.Classify(p)
+				if want == nil {
+					So(got, ShouldBeNil)
+				} else {
+					So(got, ShouldNotBeNil)
+					So(got.Value, ShouldEqual, want.Value)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkClassifier(b *testing.B) {
+	rnd := rand.New(rand.NewSource(5))
+	rules := make([]ClassRule, 1000)
+	for i := range rules {
+		maskLen := 8 + rnd.Intn(25)
+		ip := net.IPv4(10, byte(rnd.Intn(256)), byte(rnd.Intn(256)), byte(rnd.Intn(256)))
+		min := uint16(rnd.Intn(60000))
+		rules[i] = ClassRule{
+			Priority: rnd.Intn(100),
+			Src:      &net.IPNet{IP: ip.Mask(net.CIDRMask(maskLen, 32)), Mask: net.CIDRMask(maskLen, 32)},
+			DstPorts: PortRange{min, min + 1000},
+			Proto:    6,
+		}
+	}
+	c, _ := NewClassifier(rules)
+	pkt := FiveTuple{Src: net.IPv4(10, 1, 2, 3), Dst: net.IPv4(192, 0, 2, 1), Proto: 6, SrcPort: 40000, DstPort: 443}
+
+	b.Run("Classifier", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			c.Classify(pkt)
+		}
+	})
+	b.Run("Linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ClassifyLinear(rules, pkt)
+		}
+	})
+}
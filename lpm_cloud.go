@@ -0,0 +1,196 @@
+package golpm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Cloud providers known by CloudTable
+const (
+	CloudAWS   = "aws"
+	CloudGCP   = "gcp"
+	CloudAzure = "azure"
+)
+
+// CloudRange An address range published by a cloud provider
+type CloudRange struct {
+	Provider string
+	Region   string
+	Service  string
+	// NetworkBorderGroup is only published by AWS
+	NetworkBorderGroup string
+	// Tag is the Azure service tag, such as "AzureCloud.eastus"
+	Tag string
+}
+
+// CloudTable A dual-family lpm table of cloud provider ranges.
+// A prefix published several times, by several services for example,
+// holds all of its ranges.
+type CloudTable struct {
+	table *DualTable
+}
+
+// NewCloudTable Create an empty cloud range table
+func NewCloudTable() *CloudTable {
+	return &CloudTable{
+		table: NewDualLPMTable(ArchRadix),
+	}
+}
+
+// Table Return the underlying lpm table, entries are []*CloudRange.
+// Lookups ignore entries of other types added through it.
+func (ct *CloudTable) Table() LPMTable {
+	return ct.table
+}
+
+func (ct *CloudTable) Lookup(ip string) []*CloudRange {
+	ipp := net.ParseIP(ip)
+	if ipp == nil {
+		return nil
+	}
+	return ct.LookupIP(ipp)
+}
+
+// LookupIP Return the ranges of the longest prefix containing ip
+func (ct *CloudTable) LookupIP(ip net.IP) []*CloudRange {
+	entry := ct.table.LookupIP(ip)
+	if entry == nil {
+		return nil
+	}
+	ranges, _ := entry.Entry.([]*CloudRange)
+	return ranges
+}
+
+func (ct *CloudTable) add(prefix string, cloudRange *CloudRange) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	var ranges []*CloudRange
+	if entry := ct.table.GetIPNet(ipNet); entry != nil {
+		// entries of other types added through Table are replaced
+		ranges, _ = entry.Entry.([]*CloudRange)
+		for _, r := range ranges {
+			if *r == *cloudRange {
+				return nil
+			}
+		}
+	}
+	ranges = append(ranges[:len(ranges):len(ranges)], cloudRange)
+	return ct.table.AddIPNet(ipNet, ranges)
+}
+
+// LoadAWS Load an AWS ip-ranges.json document
+func (ct *CloudTable) LoadAWS(r io.Reader) error {
+	var doc struct {
+		Prefixes []struct {
+			IPPrefix           string `json:"ip_prefix"`
+			Region             string `json:"region"`
+			Service            string `json:"service"`
+			NetworkBorderGroup string `json:"network_border_group"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			IPv6Prefix         string `json:"ipv6_prefix"`
+			Region             string `json:"region"`
+			Service            string `json:"service"`
+			NetworkBorderGroup string `json:"network_border_group"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return err
+	}
+
+	for _, p := range doc.Prefixes {
+		err := ct.add(p.IPPrefix, &CloudRange{
+			Provider:           CloudAWS,
+			Region:             p.Region,
+			Service:            p.Service,
+			NetworkBorderGroup: p.NetworkBorderGroup,
+		})
+		if err != nil {
+			return fmt.Errorf("aws prefix %q: %w", p.IPPrefix, err)
+		}
+	}
+	for _, p := range doc.IPv6Prefixes {
+		err := ct.add(p.IPv6Prefix, &CloudRange{
+			Provider:           CloudAWS,
+			Region:             p.Region,
+			Service:            p.Service,
+			NetworkBorderGroup: p.NetworkBorderGroup,
+		})
+		if err != nil {
+			return fmt.Errorf("aws prefix %q: %w", p.IPv6Prefix, err)
+		}
+	}
+	return nil
+}
+
+// LoadGCP Load a Google Cloud cloud.json document
+func (ct *CloudTable) LoadGCP(r io.Reader) error {
+	var doc struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+			Service    string `json:"service"`
+			Scope      string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return err
+	}
+
+	for _, p := range doc.Prefixes {
+		prefix := p.IPv4Prefix
+		if prefix == "" {
+			prefix = p.IPv6Prefix
+		}
+		err := ct.add(prefix, &CloudRange{
+			Provider: CloudGCP,
+			Region:   p.Scope,
+			Service:  p.Service,
+		})
+		if err != nil {
+			return fmt.Errorf("gcp prefix %q: %w", prefix, err)
+		}
+	}
+	return nil
+}
+
+// LoadAzure Load an Azure ServiceTags JSON document.
+// The service of a range is its system service, or its tag when unset.
+func (ct *CloudTable) LoadAzure(r io.Reader) error {
+	var doc struct {
+		Values []struct {
+			Name       string `json:"name"`
+			Properties struct {
+				Region          string   `json:"region"`
+				SystemService   string   `json:"systemService"`
+				AddressPrefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return err
+	}
+
+	for _, value := range doc.Values {
+		service := value.Properties.SystemService
+		if service == "" {
+			service = value.Name
+		}
+		cloudRange := &CloudRange{
+			Provider: CloudAzure,
+			Region:   value.Properties.Region,
+			Service:  service,
+			Tag:      value.Name,
+		}
+		for _, prefix := range value.Properties.AddressPrefixes {
+			if err := ct.add(prefix, cloudRange); err != nil {
+				return fmt.Errorf("azure prefix %q: %w", prefix, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package golpm
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testAWSRanges = `{
+  "syncToken": "1700000000",
+  "createDate": "2023-11-14-22-13-20",
+  "prefixes": [
+    {"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2", "service": "AMAZON", "network_border_group": "ap-northeast-2"},
+    {"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2", "service": "S3", "network_border_group": "ap-northeast-2"},
+    {"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2", "service": "S3", "network_border_group": "ap-northeast-2"},
+    {"ip_prefix": "52.94.76.0/22", "region": "us-east-1", "service": "AMAZON", "network_border_group": "us-east-1"}
+  ],
+  "ipv6_prefixes": [
+    {"ipv6_prefix": "2600:1f18::/33", "region": "us-east-1", "service": "EC2", "network_border_group": "us-east-1"}
+  ]
+}`
+
+const testGCPRanges = `{
+  "syncToken": "1700000000000",
+  "creationTime": "2023-11-14T22:13:20.000000",
+  "prefixes": [
+    {"ipv4Prefix": "34.80.0.0/15", "service": "Google Cloud", "scope": "asia-east1"},
+    {"ipv6Prefix": "2600:1900:4000::/44", "service": "Google Cloud", "scope": "us-central1"}
+  ]
+}`
+
+const testAzureRanges = `{
+  "changeNumber": 1,
+  "cloud": "Public",
+  "values": [
+    {"name": "AzureCloud", "id": "AzureCloud", "properties": {"region": "", "systemService": "", "addressPrefixes": ["20.36.0.0/14"]}},
+    {"name": "AzureCloud.eastus", "id": "AzureCloud.eastus", "properties": {"region": "eastus", "systemService": "", "addressPrefixes": ["20.36.0.0/14", "2603:1030::/40"]}},
+    {"name": "Storage.EastUS", "id": "Storage.EastUS", "properties": {"region": "eastus", "systemService": "AzureStorage", "addressPrefixes": ["20.38.98.0/24"]}}
+  ]
+}`
+
+func TestCloudTable(t *testing.T) {
+	Convey("Load provider ranges into one table", t, func() {
+		table := NewCloudTable()
+		So(table.LoadAWS(strings.NewReader(testAWSRanges)), ShouldBeNil)
+		So(table.LoadGCP(strings.NewReader(testGCPRanges)), ShouldBeNil)
+		So(table.LoadAzure(strings.NewReader(testAzureRanges)), ShouldBeNil)
+
+		ranges := table.Lookup("3.5.141.1")
+		So(len(ranges), ShouldEqual, 2)
+		So(*ranges[0], ShouldResemble, CloudRange{Provider: CloudAWS, Region: "ap-northeast-2", Service: "AMAZON", NetworkBorderGroup: "ap-northeast-2"})
+		So(ranges[1].Service, ShouldEqual, "S3")
+
+		ranges = table.Lookup("2600:1f18::1")
+		So(len(ranges), ShouldEqual, 1)
+		So(ranges[0].Region, ShouldEqual, "us-east-1")
+
+		ranges = table.Lookup("34.81.0.1")
+		So(len(ranges), ShouldEqual, 1)
+		So(*ranges[0], ShouldResemble, CloudRange{Provider: CloudGCP, Region: "asia-east1", Service: "Google Cloud"})
+		So(table.Lookup("2600:1900:4000::1")[0].Region, ShouldEqual, "us-central1")
+
+		ranges = table.Lookup("20.37.0.1")
+		So(len(ranges), ShouldEqual, 2)
+		So(ranges[0].Tag, ShouldEqual, "AzureCloud")
+		So(ranges[1].Tag, ShouldEqual, "AzureCloud.eastus")
+		So(ranges[1].Region, ShouldEqual, "eastus")
+
+		ranges = table.Lookup("20.38.98.1")
+		So(len(ranges), ShouldEqual, 1)
+		So(ranges[0].Service, ShouldEqual, "AzureStorage")
+
+		So(table.Lookup("2603:1030::1")[0].Tag, ShouldEqual, "AzureCloud.eastus")
+		So(table.Lookup("8.8.8.8"), ShouldBeNil)
+		So(table.Lookup("bad ip"), ShouldBeNil)
+
+		// entries of other types added through Table are ignored
+		So(table.Table().Add("8.8.8.0/24", "not ranges"), ShouldBeNil)
+		So(table.Lookup("8.8.8.8"), ShouldBeNil)
+		So(table.LoadAWS(strings.NewReader(`{"prefixes": [{"ip_prefix": "8.8.8.0/24", "region": "x"}]}`)), ShouldBeNil)
+		So(table.Lookup("8.8.8.8")[0].Region, ShouldEqual, "x")
+	})
+
+	Convey("Load malformed documents", t, func() {
+		table := NewCloudTable()
+		So(table.LoadAWS(strings.NewReader(`{"prefixes": [{"ip_prefix": "3.5.140.0/33"}]}`)), ShouldBeError)
+		So(table.LoadGCP(strings.NewReader(`{"prefixes": [{}]}`)), ShouldBeError)
+		So(table.LoadAzure(strings.NewReader(`not json`)), ShouldBeError)
+	})
+}
@@ -0,0 +1,342 @@
+package golpm
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// DiffOp The kind of a prefix difference
+type DiffOp int
+
+const (
+	DiffAdded DiffOp = iota
+	DiffRemoved
+	DiffChanged
+)
+
+func (op DiffOp) String() string {
+	switch op {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	}
+	return "unknown"
+}
+
+// DiffEntry A prefix present in only one table, or with different entries.
+// Old is nil for added prefixes and New is nil for removed ones.
+type DiffEntry struct {
+	Op     DiffOp
+	Prefix *net.IPNet
+	Old    *Entry
+	New    *Entry
+}
+
+// TableDiff The differences between two tables, each list in prefix order
+type TableDiff struct {
+	Added   []DiffEntry
+	Removed []DiffEntry
+	Changed []DiffEntry
+}
+
+// RangeChange An address range whose lookup result differs between two tables
+type RangeChange struct {
+	Start net.IP
+	End   net.IP
+	Old   *Entry
+	New   *Entry
+}
+
+// Diff Return the prefixes added, removed and changed from a to b, entries
+// being compared with eq (reflect.DeepEqual when nil).
+func Diff(a, b LPMTable, eq EqualFunc) *TableDiff {
+	diff := &TableDiff{}
+	DiffFunc(a, b, eq, func(d DiffEntry) bool {
+		switch d.Op {
+		case DiffAdded:
+			diff.Added = append(diff.Added, d)
+		case DiffRemoved:
+			diff.Removed = append(diff.Removed, d)
+		default:
+			diff.Changed = append(diff.Changed, d)
+		}
+		return true
+	})
+	return diff
+}
+
+// DiffFunc Call fn for each difference from a to b in prefix order until
+// fn returns false. Radix tables are walked in step, so no copy of the
+// tables is made.
+func DiffFunc(a, b LPMTable, eq EqualFunc, fn func(d DiffEntry) bool) {
+	eq = equalOrDefault(eq)
+	ca, cb := tableCursor(a), tableCursor(b)
+	ea, eb := ca.next(), cb.next()
+	for ea != nil || eb != nil {
+		var d DiffEntry
+		cmp := 0
+		switch {
+		case ea == nil:
+			cmp = 1
+		case eb == nil:
+			cmp = -1
+		default:
+			cmp = comparePrefix(ea.Prefix, eb.Prefix)
+		}
+
+		switch {
+		case cmp < 0:
+			d = DiffEntry{Op: DiffRemoved, Prefix: ea.Prefix, Old: ea}
+			ea = ca.next()
+		case cmp > 0:
+			d = DiffEntry{Op: DiffAdded, Prefix: eb.Prefix, New: eb}
+			eb = cb.next()
+		default:
+			changed := !sameEntry(ea, eb, eq) || !samePrefixes(ea.Except, eb.Except)
+			d = DiffEntry{Op: DiffChanged, Prefix: eb.Prefix, Old: ea, New: eb}
+			ea, eb = ca.next(), cb.next()
+			if !changed {
+				continue
+			}
+		}
+		if !fn(d) {
+			return
+		}
+	}
+}
+
+// SemanticDiff Return the address ranges whose lookup result differs from
+// a to b, in address order. Each range has a single old and new entry.
+// Prefixes changed without effect on any lookup, such as a shadowed
+// prefix, are not reported.
+func SemanticDiff(a, b LPMTable, eq EqualFunc) []RangeChange {
+	var changes []RangeChange
+	SemanticDiffFunc(a, b, eq, func(change RangeChange) bool {
+		changes = append(changes, change)
+		return true
+	})
+	return changes
+}
+
+// SemanticDiffFunc Call fn for each range of SemanticDiff until fn returns false
+func SemanticDiffFunc(a, b LPMTable, eq EqualFunc, fn func(change RangeChange) bool) {
+	eq = equalOrDefault(eq)
+
+	// lookups are constant between two consecutive prefix boundaries
+	var points []net.IP
+	for _, table := range []LPMTable{a, b} {
+		cursor := tableCursor(table)
+		for entry := cursor.next(); entry != nil; entry = cursor.next() {
+			points = appendBoundaries(points, entry.Prefix)
+			for _, exceptNet := range entry.Except {
+				points = appendBoundaries(points, exceptNet)
+			}
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return compareIP(points[i], points[j]) < 0
+	})
+
+	for i, point := range points {
+		if i > 0 && bytes.Equal(point, points[i-1]) {
+			continue
+		}
+		// the range ends before the next boundary of the same family
+		end := make(net.IP, len(point))
+		setIPHostBits(end, end, len(point)*8)
+		for j := i + 1; j < len(points); j++ {
+			if len(points[j]) != len(point) {
+				break
+			}
+			if !bytes.Equal(points[j], point) {
+				copy(end, points[j])
+				decrementIP(end)
+				break
+			}
+		}
+
+		ea, eb := a.LookupIP(point), b.LookupIP(point)
+		if ea == nil && eb == nil || ea != nil && eb != nil && sameEntry(ea, eb, eq) {
+			continue
+		}
+		change := RangeChange{
+			Start: point,
+			End:   end,
+			Old:   ea,
+			New:   eb,
+		}
+		if !fn(change) {
+			return
+		}
+	}
+}
+
+// appendBoundaries Append the first address of prefix and the address
+// following its last one, unless it wraps around
+func appendBoundaries(points []net.IP, prefix *net.IPNet) []net.IP {
+	maskSize, bits := prefix.Mask.Size()
+	ip := prefix.IP
+	if bits == 8*net.IPv4len {
+		ip = ip.To4()
+	}
+	start := append(net.IP(nil), ip...)
+	points = append(points, start)
+
+	next := make(net.IP, len(ip))
+	setIPHostBits(next, ip, bits-maskSize)
+	incrementIP(next)
+	if compareIP(next, start) > 0 {
+		points = append(points, next)
+	}
+	return points
+}
+
+// sameEntry Report whether a and b have the same route type and equivalent entries
+func sameEntry(a, b *Entry, eq EqualFunc) bool {
+	return a.Type == b.Type && eq(a.Entry, b.Entry)
+}
+
+// samePrefixes Report whether a and b hold the same prefixes in any order
+func samePrefixes(a, b []*net.IPNet) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if comparePrefix(x, y) == 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// compareIP Compare two addresses, ipv4 addresses of 4 bytes sorting first
+func compareIP(a, b net.IP) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(a, b)
+}
+
+// comparePrefix Compare two prefixes by network address, then mask length
+func comparePrefix(a, b *net.IPNet) int {
+	ipa, ipb := a.IP, b.IP
+	if ip4 := ipa.To4(); ip4 != nil {
+		ipa = ip4
+	}
+	if ip4 := ipb.To4(); ip4 != nil {
+		ipb = ip4
+	}
+	if cmp := compareIP(ipa, ipb); cmp != 0 {
+		return cmp
+	}
+	sa, _ := a.Mask.Size()
+	sb, _ := b.Mask.Size()
+	return sa - sb
+}
+
+// entryCursor An iterator over the entries of a table in prefix order
+type entryCursor interface {
+	next() *Entry
+}
+
+func tableCursor(table LPMTable) entryCursor {
+	switch t := table.(type) {
+	case *RadixTable:
+		cursor := &radixCursor{pending: t.defaultEntry}
+		cursor.stack = append(cursor.stack, radixFrame{node: t.root, pos: len(t.root.entries)})
+		return cursor
+	case *DualTable:
+		return &chainCursor{cursors: []entryCursor{tableCursor(t.V4), tableCursor(t.V6)}}
+	}
+
+	var entries []*Entry
+	for _, list := range table.Show() {
+		for i := range list {
+			entries = append(entries, &list[i])
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return comparePrefix(entries[i].Prefix, entries[j].Prefix) < 0
+	})
+	return &sliceCursor{entries: entries}
+}
+
+type radixFrame struct {
+	node *radixNode
+	pos  int // entries first, then children
+}
+
+type radixCursor struct {
+	pending *Entry
+	stack   []radixFrame
+}
+
+func (rc *radixCursor) next() *Entry {
+	if entry := rc.pending; entry != nil {
+		rc.pending = nil
+		return entry
+	}
+	for len(rc.stack) > 0 {
+		frame := &rc.stack[len(rc.stack)-1]
+		node := frame.node
+		if frame.pos < len(node.entries) {
+			entry := node.entries[frame.pos]
+			frame.pos++
+			if entry != nil {
+				return entry
+			}
+			continue
+		}
+		child := frame.pos - len(node.entries)
+		if child >= len(node.children) {
+			rc.stack = rc.stack[:len(rc.stack)-1]
+			continue
+		}
+		frame.pos++
+		if node.children[child] != nil {
+			rc.stack = append(rc.stack, radixFrame{node: node.children[child]})
+		}
+	}
+	return nil
+}
+
+type chainCursor struct {
+	cursors []entryCursor
+}
+
+func (cc *chainCursor) next() *Entry {
+	for len(cc.cursors) > 0 {
+		if entry := cc.cursors[0].next(); entry != nil {
+			return entry
+		}
+		cc.cursors = cc.cursors[1:]
+	}
+	return nil
+}
+
+type sliceCursor struct {
+	entries []*Entry
+}
+
+func (sc *sliceCursor) next() *Entry {
+	if len(sc.entries) == 0 {
+		return nil
+	}
+	entry := sc.entries[0]
+	sc.entries = sc.entries[1:]
+	return entry
+}
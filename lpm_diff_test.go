@@ -0,0 +1,118 @@
+package golpm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func diffPrefixes(entries []DiffEntry) []string {
+	var prefixes []string
+	for _, entry := range entries {
+		prefixes = append(prefixes, entry.Prefix.String())
+	}
+	return prefixes
+}
+
+func TestDiff(t *testing.T) {
+	Convey("Diff two radix tables", t, func() {
+		a := NewRadixLPMTable(false)
+		a.Add("0.0.0.0/0", "gw0")
+		a.Add("10.0.0.0/8", "gw1")
+		a.Add("10.1.0.0/16", "gw2")
+		a.Add("192.168.0.0/16", "gw3")
+		a.Add("192.168.1.0/24", "gw3")
+
+		b := NewRadixLPMTable(false)
+		b.Add("0.0.0.0/0", "gw0")
+		b.Add("10.0.0.0/8", "gw9")
+		b.Add("10.0.0.0/9", "gw1")
+		b.Add("172.16.0.0/12", "gw4")
+		b.Add("192.168.1.0/24", "gw3")
+
+		diff := Diff(a, b, nil)
+		So(diffPrefixes(diff.Added), ShouldResemble, []string{"10.0.0.0/9", "172.16.0.0/12"})
+		So(diffPrefixes(diff.Removed), ShouldResemble, []string{"10.1.0.0/16", "192.168.0.0/16"})
+		So(diffPrefixes(diff.Changed), ShouldResemble, []string{"10.0.0.0/8"})
+		So(diff.Changed[0].Old.Entry, ShouldEqual, "gw1")
+		So(diff.Changed[0].New.Entry, ShouldEqual, "gw9")
+		So(diff.Added[0].Old, ShouldBeNil)
+		So(diff.Removed[0].New, ShouldBeNil)
+
+		var ops []string
+		DiffFunc(a, b, nil, func(d DiffEntry) bool {
+			ops = append(ops, d.Op.String()+" "+d.Prefix.String())
+			return len(ops) < 3
+		})
+		So(ops, ShouldResemble, []string{"changed 10.0.0.0/8", "added 10.0.0.0/9", "removed 10.1.0.0/16"})
+
+		So(Diff(a, a, nil).Changed, ShouldBeEmpty)
+	})
+
+	Convey("Diff with an equality function", t, func() {
+		a := NewRadixLPMTable(false)
+		a.Add("10.0.0.0/8", "GW1")
+		b := NewRadixLPMTable(false)
+		b.Add("10.0.0.0/8", "gw1")
+		So(len(Diff(a, b, nil).Changed), ShouldEqual, 1)
+		So(len(Diff(a, b, func(x, y interface{}) bool { return true }).Changed), ShouldEqual, 0)
+	})
+
+	Convey("Diff dual tables", t, func() {
+		a := NewDualLPMTable(ArchRadix)
+		a.Add("10.0.0.0/8", 1)
+		a.Add("2001:db8::/32", 1)
+		b := NewDualLPMTable(ArchRadix)
+		b.Add("10.0.0.0/8", 1)
+		b.Add("2001:db8::/48", 1)
+		diff := Diff(a, b, nil)
+		So(diffPrefixes(diff.Added), ShouldResemble, []string{"2001:db8::/48"})
+		So(diffPrefixes(diff.Removed), ShouldResemble, []string{"2001:db8::/32"})
+	})
+}
+
+func TestSemanticDiff(t *testing.T) {
+	Convey("Report ranges whose lookup changed", t, func() {
+		a := NewRadixLPMTable(false)
+		a.Add("10.0.0.0/8", "gw1")
+		a.Add("10.1.0.0/16", "gw1")
+		a.Add("192.168.0.0/24", "gw2")
+
+		b := NewRadixLPMTable(false)
+		b.Add("10.0.0.0/8", "gw1")
+		b.Add("10.0.0.0/24", "gw3")
+		b.Add("10.0.1.0/24", "gw3")
+		b.Add("192.168.0.0/25", "gw2")
+		b.Add("255.255.255.255/32", "gw4")
+
+		changes := SemanticDiff(a, b, nil)
+		So(len(changes), ShouldEqual, 4)
+		So(changes[0].Start.String(), ShouldEqual, "10.0.0.0")
+		So(changes[0].End.String(), ShouldEqual, "10.0.0.255")
+		So(changes[0].Old.Entry, ShouldEqual, "gw1")
+		So(changes[0].New.Prefix.String(), ShouldEqual, "10.0.0.0/24")
+		So(changes[1].Start.String(), ShouldEqual, "10.0.1.0")
+		So(changes[1].End.String(), ShouldEqual, "10.0.1.255")
+		So(changes[1].New.Prefix.String(), ShouldEqual, "10.0.1.0/24")
+		So(changes[2].Start.String(), ShouldEqual, "192.168.0.128")
+		So(changes[2].End.String(), ShouldEqual, "192.168.0.255")
+		So(changes[2].New, ShouldBeNil)
+		So(changes[3].Start.String(), ShouldEqual, "255.255.255.255")
+		So(changes[3].End.String(), ShouldEqual, "255.255.255.255")
+		So(changes[3].Old, ShouldBeNil)
+
+		So(SemanticDiff(a, a, nil), ShouldBeEmpty)
+	})
+
+	Convey("Report ipv6 ranges", t, func() {
+		a := NewRadixLPMTable(true)
+		a.Add("::/0", "default")
+		b := NewRadixLPMTable(true)
+		b.Add("::/0", "default")
+		b.Add("2001:db8::/32", "doc")
+		changes := SemanticDiff(a, b, nil)
+		So(len(changes), ShouldEqual, 1)
+		So(changes[0].Start.String(), ShouldEqual, "2001:db8::")
+		So(changes[0].End.String(), ShouldEqual, "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff")
+	})
+}
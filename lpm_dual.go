@@ -0,0 +1,134 @@
+package golpm
+
+import (
+	"net"
+)
+
+// DualTable A lpm table holding both ipv4 and ipv6 entries, each family
+// is kept in its own table and requests are dispatched by address family.
+type DualTable struct {
+	V4 LPMTable
+	V6 LPMTable
+}
+
+// NewDualLPMTable Create a dual-family lpm table based on specify arch.
+func NewDualLPMTable(arch string) *DualTable {
+	return &DualTable{
+		V4: NewLPMTable(arch, false),
+		V6: NewLPMTable(arch, true),
+	}
+}
+
+func (dt *DualTable) tableFor(ip net.IP) LPMTable {
+	if ip.To4() != nil {
+		return dt.V4
+	}
+	return dt.V6
+}
+
+// Show Return the lpm table in format: maskLen -> entry list.
+// ipv4 entries are listed before ipv6 entries of the same mask length.
+func (dt *DualTable) Show() map[int][]Entry {
+	entries := dt.V4.Show()
+	for maskLen, list := range dt.V6.Show() {
+		entries[maskLen] = append(entries[maskLen], list...)
+	}
+	return entries
+}
+
+func (dt *DualTable) Add(prefix string, entry interface{}) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return dt.AddIPNet(ipNet, entry)
+}
+
+func (dt *DualTable) AddIPNet(prefix *net.IPNet, entry interface{}) error {
+	return dt.tableFor(prefix.IP).AddIPNet(prefix, entry)
+}
+
+func (dt *DualTable) Delete(prefix string) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return dt.DeleteIPNet(ipNet)
+}
+
+func (dt *DualTable) DeleteIPNet(prefix *net.IPNet) error {
+	return dt.tableFor(prefix.IP).DeleteIPNet(prefix)
+}
+
+func (dt *DualTable) AddRange(start, end net.IP, entry interface{}) error {
+	return dt.tableFor(start).AddRange(start, end, entry)
+}
+
+func (dt *DualTable) DeleteRange(start, end net.IP) error {
+	return dt.tableFor(start).DeleteRange(start, end)
+}
+
+func (dt *DualTable) AddTyped(prefix string, typ RouteType, entry interface{}) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return dt.AddIPNetTyped(ipNet, typ, entry)
+}
+
+func (dt *DualTable) AddIPNetTyped(prefix *net.IPNet, typ RouteType, entry interface{}) error {
+	return addIPNetTyped(dt.tableFor(prefix.IP), prefix, typ, entry)
+}
+
+func (dt *DualTable) AddExcept(prefix string, except []string, entry interface{}) error {
+	_, ipNet, excepts, err := parseExcept(prefix, except)
+	if err != nil {
+		return err
+	}
+	return dt.AddIPNetExcept(ipNet, excepts, entry)
+}
+
+func (dt *DualTable) AddIPNetExcept(prefix *net.IPNet, except []*net.IPNet, entry interface{}) error {
+	return addIPNetExcept(dt.tableFor(prefix.IP), prefix, except, entry)
+}
+
+func (dt *DualTable) Get(prefix string) *Entry {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil
+	}
+	return dt.GetIPNet(ipNet)
+}
+
+func (dt *DualTable) GetIPNet(prefix *net.IPNet) *Entry {
+	return getIPNet(dt.tableFor(prefix.IP), prefix)
+}
+
+func (dt *DualTable) Lookup(ip string) *Entry {
+	var buf [net.IPv6len]byte
+	ipp := parseIP(ip, &buf)
+	if ipp == nil {
+		return nil
+	}
+	// the radix tables are called directly so that buf does not escape
+	if rt, ok := dt.tableFor(ipp).(*RadixTable); ok {
+		return rt.LookupIP(ipp)
+	}
+	return dt.LookupIP(append(net.IP(nil), ipp...))
+}
+
+func (dt *DualTable) LookupIP(ip net.IP) *Entry {
+	return dt.tableFor(ip).LookupIP(ip)
+}
+
+func (dt *DualTable) LookupRoute(ip string) LookupResult {
+	ipp := net.ParseIP(ip)
+	if ipp == nil {
+		return LookupResult{}
+	}
+	return dt.LookupRouteIP(ipp)
+}
+
+func (dt *DualTable) LookupRouteIP(ip net.IP) LookupResult {
+	return lookupRouteIP(dt.tableFor(ip), ip)
+}
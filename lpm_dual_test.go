@@ -0,0 +1,64 @@
+package golpm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDualTable(t *testing.T) {
+	var err error
+
+	Convey("Add and lookup entries of both families", t, func() {
+		table := NewDualLPMTable(ArchRadix)
+		err = table.Add("10.0.0.0/8", "v4")
+		So(err, ShouldBeNil)
+		err = table.Add("2001:db8::/32", "v6")
+		So(err, ShouldBeNil)
+		err = table.Add("::/0", "v6 default")
+		So(err, ShouldBeNil)
+
+		So(table.Lookup("10.1.2.3").Entry, ShouldEqual, "v4")
+		So(table.Lookup("::ffff:10.1.2.3").Entry, ShouldEqual, "v4")
+		So(table.Lookup("2001:db8::1").Entry, ShouldEqual, "v6")
+		So(table.Lookup("2001:db9::1").Entry, ShouldEqual, "v6 default")
+		So(table.Lookup("11.0.0.1"), ShouldBeNil)
+		So(table.Lookup("not an ip"), ShouldBeNil)
+
+		entries := table.Show()
+		So(len(entries[8]), ShouldEqual, 1)
+		So(len(entries[32]), ShouldEqual, 1)
+		So(len(entries[0]), ShouldEqual, 1)
+	})
+
+	Convey("Delete entries of both families", t, func() {
+		table := NewDualLPMTable(ArchRadix)
+		table.Add("10.0.0.0/8", "v4")
+		table.Add("2001:db8::/32", "v6")
+		err = table.Delete("10.0.0.0/8")
+		So(err, ShouldBeNil)
+		err = table.Delete("2001:db8::/32")
+		So(err, ShouldBeNil)
+		err = table.Delete("2001:db8::/129")
+		So(err, ShouldBeError)
+		So(table.Lookup("10.1.2.3"), ShouldBeNil)
+		So(table.Lookup("2001:db8::1"), ShouldBeNil)
+	})
+
+	Convey("Hold tables implementing only LPMTable", t, func() {
+		// embedding the interface hides the optional methods
+		type plainTable struct{ LPMTable }
+		table := &DualTable{
+			V4: plainTable{NewRadixLPMTable(false)},
+			V6: plainTable{NewRadixLPMTable(true)},
+		}
+		So(table.Add("10.0.0.0/8", "v4"), ShouldBeNil)
+		So(table.AddTyped("10.1.0.0/16", RouteUnicast, "unicast"), ShouldBeNil)
+		So(table.AddTyped("10.2.0.0/16", RouteBlackhole, nil), ShouldBeError)
+		So(table.AddExcept("10.3.0.0/16", []string{"10.3.1.0/24"}, "x"), ShouldBeError)
+		So(table.Get("10.1.0.0/16").Entry, ShouldEqual, "unicast")
+		So(table.Get("10.4.0.0/16"), ShouldBeNil)
+		So(table.LookupRoute("10.1.2.3").Entry.Entry, ShouldEqual, "unicast")
+		So(table.LookupRoute("11.0.0.1").Found, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,169 @@
+package golpm
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// DefaultECMPBuckets The number of buckets of a next-hop group by default
+const DefaultECMPBuckets = 256
+
+// NextHop A member of a next-hop group
+type NextHop struct {
+	Value  interface{}
+	Weight int // share of the flows, weights below 1 count as 1
+}
+
+// NextHopGroup An entry spreading flows over equal-cost next hops. Flows
+// are hashed to buckets owned by the members in proportion to their weight;
+// when members change, only the buckets needed to restore the proportions
+// move, so removing a member only remaps the flows it carried.
+type NextHopGroup struct {
+	members []*NextHop
+	buckets []*NextHop
+}
+
+// NewNextHopGroup Create a group of members with the given number of
+// buckets, DefaultECMPBuckets when not positive
+func NewNextHopGroup(buckets int, members ...*NextHop) *NextHopGroup {
+	if buckets <= 0 {
+		buckets = DefaultECMPBuckets
+	}
+	group := &NextHopGroup{
+		members: append([]*NextHop(nil), members...),
+		buckets: make([]*NextHop, buckets),
+	}
+	group.rebalance()
+	return group
+}
+
+// Members Return the members in the order they were added
+func (g *NextHopGroup) Members() []*NextHop {
+	return append([]*NextHop(nil), g.members...)
+}
+
+// Add Add member to the group
+func (g *NextHopGroup) Add(member *NextHop) {
+	g.members = append(g.members, member)
+	g.rebalance()
+}
+
+// Remove Remove member from the group, reporting whether it was found
+func (g *NextHopGroup) Remove(member *NextHop) bool {
+	for i, m := range g.members {
+		if m == member {
+			g.members = append(g.members[:i:i], g.members[i+1:]...)
+			g.rebalance()
+			return true
+		}
+	}
+	return false
+}
+
+// SetWeight Change the weight of member
+func (g *NextHopGroup) SetWeight(member *NextHop, weight int) {
+	member.Weight = weight
+	g.rebalance()
+}
+
+// Select Return the member carrying the flow, nil for an empty group
+func (g *NextHopGroup) Select(flowKey []byte) *NextHop {
+	// inline 64-bit FNV-1a, to keep lookups free of allocations
+	hash := uint64(14695981039346656037)
+	for _, b := range flowKey {
+		hash ^= uint64(b)
+		hash *= 1099511628211
+	}
+	return g.buckets[hash%uint64(len(g.buckets))]
+}
+
+// quotas Return the number of buckets of each member, by largest remainder
+func (g *NextHopGroup) quotas() map[*NextHop]int {
+	quotas := make(map[*NextHop]int, len(g.members))
+	total := 0
+	for _, m := range g.members {
+		total += memberWeight(m)
+	}
+	if total == 0 {
+		return quotas
+	}
+
+	left := len(g.buckets)
+	remainders := make([]int, len(g.members))
+	for i, m := range g.members {
+		share := len(g.buckets) * memberWeight(m)
+		quotas[m] = share / total
+		remainders[i] = share % total
+		left -= quotas[m]
+	}
+	for ; left > 0; left-- {
+		best := 0
+		for i := range remainders {
+			if remainders[i] > remainders[best] {
+				best = i
+			}
+		}
+		quotas[g.members[best]]++
+		remainders[best] = -1
+	}
+	return quotas
+}
+
+func memberWeight(member *NextHop) int {
+	if member.Weight < 1 {
+		return 1
+	}
+	return member.Weight
+}
+
+// rebalance Move the buckets of removed members and members over their
+// quota to members under it, keeping every other bucket in place
+func (g *NextHopGroup) rebalance() {
+	quotas := g.quotas()
+	counts := make(map[*NextHop]int, len(g.members))
+	var free []int
+	for b, owner := range g.buckets {
+		if quota, ok := quotas[owner]; ok && counts[owner] < quota {
+			counts[owner]++
+			continue
+		}
+		g.buckets[b] = nil
+		free = append(free, b)
+	}
+	for _, m := range g.members {
+		for ; counts[m] < quotas[m] && len(free) > 0; counts[m]++ {
+			g.buckets[free[0]] = m
+			free = free[1:]
+		}
+	}
+}
+
+// FlowKey Return the flow key of a five-tuple
+func FlowKey(src, dst net.IP, proto uint8, srcPort, dstPort uint16) []byte {
+	key := make([]byte, 0, 2*net.IPv6len+5)
+	key = append(key, src.To16()...)
+	key = append(key, dst.To16()...)
+	key = append(key, proto)
+	key = binary.BigEndian.AppendUint16(key, srcPort)
+	return binary.BigEndian.AppendUint16(key, dstPort)
+}
+
+// LookupFlow Return the entry matching ip and, when it is a *NextHopGroup,
+// the member carrying the flow. For other entries the next hop is nil.
+func (rt *RadixTable) LookupFlow(ip net.IP, flowKey []byte) (*Entry, *NextHop) {
+	return selectFlow(rt.LookupIP(ip), flowKey)
+}
+
+func (dt *DualTable) LookupFlow(ip net.IP, flowKey []byte) (*Entry, *NextHop) {
+	return selectFlow(dt.LookupIP(ip), flowKey)
+}
+
+func selectFlow(entry *Entry, flowKey []byte) (*Entry, *NextHop) {
+	if entry == nil {
+		return nil, nil
+	}
+	if group, ok := entry.Entry.(*NextHopGroup); ok {
+		return entry, group.Select(flowKey)
+	}
+	return entry, nil
+}
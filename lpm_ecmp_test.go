@@ -0,0 +1,111 @@
+package golpm
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNextHopGroup(t *testing.T) {
+	flows := make([][]byte, 5000)
+	for i := range flows {
+		flows[i] = FlowKey(net.IPv4(10, 0, byte(i>>8), byte(i)), net.ParseIP("192.0.2.1"), 6, uint16(1024+i), 443)
+	}
+	assign := func(group *NextHopGroup) []*NextHop {
+		out := make([]*NextHop, len(flows))
+		for i, flow := range flows {
+			out[i] = group.Select(flow)
+		}
+		return out
+	}
+
+	Convey("Spread buckets by weight", t, func() {
+		a, b, c := &NextHop{Value: "a"}, &NextHop{Value: "b", Weight: 2}, &NextHop{Value: "c", Weight: 1}
+		group := NewNextHopGroup(0, a, b, c)
+		counts := make(map[*NextHop]int)
+		for _, owner := range group.buckets {
+			counts[owner]++
+		}
+		So(len(group.buckets), ShouldEqual, DefaultECMPBuckets)
+		So(counts[a], ShouldEqual, 64)
+		So(counts[b], ShouldEqual, 128)
+		So(counts[c], ShouldEqual, 64)
+
+		So(assign(group), ShouldResemble, assign(group))
+		So(group.Members(), ShouldResemble, []*NextHop{a, b, c})
+	})
+
+	Convey("Remap only the flows of a removed member", t, func() {
+		members := []*NextHop{{Value: "a"}, {Value: "b"}, {Value: "c"}, {Value: "d"}}
+		group := NewNextHopGroup(64, members...)
+		before := assign(group)
+
+		So(group.Remove(members[2]), ShouldBeTrue)
+		So(group.Remove(members[2]), ShouldBeFalse)
+		after := assign(group)
+		moved := 0
+		for i := range flows {
+			if before[i] != members[2] {
+				So(after[i], ShouldEqual, before[i])
+			} else {
+				So(after[i], ShouldNotEqual, members[2])
+				moved++
+			}
+		}
+		So(moved, ShouldBeGreaterThan, 0)
+
+		Convey("Move only the buckets needed for a new member", func() {
+			group.Add(members[2])
+			again := assign(group)
+			for i := range flows {
+				if again[i] != members[2] {
+					So(again[i], ShouldEqual, after[i])
+				}
+			}
+		})
+
+		Convey("Follow weight changes", func() {
+			group.SetWeight(members[0], 2)
+			counts := make(map[*NextHop]int)
+			for _, owner := range group.buckets {
+				counts[owner]++
+			}
+			So(counts[members[0]], ShouldEqual, 32)
+			So(counts[members[1]]+counts[members[3]], ShouldEqual, 32)
+		})
+
+		Convey("Empty groups have no next hop", func() {
+			for _, m := range members {
+				group.Remove(m)
+			}
+			So(group.Select(flows[0]), ShouldBeNil)
+		})
+	})
+
+	Convey("Look up flows in a table", t, func() {
+		table := NewDualLPMTable(ArchRadix)
+		members := []*NextHop{{Value: "a"}, {Value: "b"}}
+		table.Add("10.0.0.0/8", NewNextHopGroup(16, members...))
+		table.Add("2001:db8::/32", "single")
+
+		seen := make(map[interface{}]bool)
+		for i := 0; i < 100; i++ {
+			key := []byte(fmt.Sprint("flow", i))
+			entry, hop := table.LookupFlow(net.ParseIP("10.1.2.3"), key)
+			So(entry.Prefix.String(), ShouldEqual, "10.0.0.0/8")
+			_, again := table.LookupFlow(net.ParseIP("10.1.2.3"), key)
+			So(again, ShouldEqual, hop)
+			seen[hop.Value] = true
+		}
+		So(len(seen), ShouldEqual, 2)
+
+		entry, hop := table.LookupFlow(net.ParseIP("2001:db8::1"), nil)
+		So(entry.Entry, ShouldEqual, "single")
+		So(hop, ShouldBeNil)
+		entry, hop = table.LookupFlow(net.ParseIP("192.0.2.1"), nil)
+		So(entry, ShouldBeNil)
+		So(hop, ShouldBeNil)
+	})
+}
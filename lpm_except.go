@@ -0,0 +1,113 @@
+package golpm
+
+import (
+	"fmt"
+	"net"
+)
+
+// ExceptAdder A lpm table storing entries with excluded sub-prefixes.
+// The tables of this package implement it.
+type ExceptAdder interface {
+	AddExcept(prefix string, except []string, entry interface{}) error
+	AddIPNetExcept(prefix *net.IPNet, except []*net.IPNet, entry interface{}) error
+}
+
+// addIPNetExcept Add entry for prefix except the excluded sub-prefixes to
+// table, which must implement ExceptAdder unless except is empty
+func addIPNetExcept(table LPMTable, prefix *net.IPNet, except []*net.IPNet, entry interface{}) error {
+	if adder, ok := table.(ExceptAdder); ok {
+		return adder.AddIPNetExcept(prefix, except, entry)
+	}
+	if len(except) != 0 {
+		return fmt.Errorf("%T does not support excluded prefixes", table)
+	}
+	return table.AddIPNet(prefix, entry)
+}
+
+// AddExcept Add entry for prefix, except for the addresses of the excluded
+// sub-prefixes, which fall through to the next shorter matching prefix.
+func (rt *RadixTable) AddExcept(prefix string, except []string, entry interface{}) error {
+	_, ipNet, excepts, err := parseExcept(prefix, except)
+	if err != nil {
+		return err
+	}
+	return rt.AddIPNetExcept(ipNet, excepts, entry)
+}
+
+func (rt *RadixTable) AddIPNetExcept(prefix *net.IPNet, except []*net.IPNet, entry interface{}) error {
+	if err := checkExcept(prefix, except); err != nil {
+		return err
+	}
+	newEntry := &Entry{
+		Prefix: prefix,
+		Entry:  entry,
+	}
+	if len(except) != 0 {
+		newEntry.Except = append([]*net.IPNet(nil), except...)
+	}
+	return rt.insert(newEntry)
+}
+
+func parseExcept(prefix string, except []string) (net.IP, *net.IPNet, []*net.IPNet, error) {
+	ip, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	excepts := make([]*net.IPNet, 0, len(except))
+	for _, s := range except {
+		_, exceptNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		excepts = append(excepts, exceptNet)
+	}
+	return ip, ipNet, excepts, nil
+}
+
+// checkExcept Check that every excluded prefix is inside prefix
+func checkExcept(prefix *net.IPNet, except []*net.IPNet) error {
+	maskSize, bits := prefix.Mask.Size()
+	for _, exceptNet := range except {
+		exceptSize, exceptBits := exceptNet.Mask.Size()
+		if exceptBits != bits || exceptSize < maskSize || !prefix.Contains(exceptNet.IP) {
+			return fmt.Errorf("excluded prefix %s is not inside %s", exceptNet, prefix)
+		}
+	}
+	return nil
+}
+
+// excludes Report whether ip is inside one of the excluded prefixes
+func (e *Entry) excludes(ip net.IP) bool {
+	for _, exceptNet := range e.Except {
+		if exceptNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludesPrefix Report whether one of the excluded prefixes contains prefix
+func (e *Entry) excludesPrefix(prefix *net.IPNet) bool {
+	maskSize, _ := prefix.Mask.Size()
+	for _, exceptNet := range e.Except {
+		exceptSize, _ := exceptNet.Mask.Size()
+		if exceptSize <= maskSize && exceptNet.Contains(prefix.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// fallbackEntry Return the entry a lookup inside prefix falls through to
+// when no entry of prefix length or longer matches, nil for no route
+func fallbackEntry(table LPMTable, prefix *net.IPNet) *Entry {
+	maskSize, bits := prefix.Mask.Size()
+	for m := maskSize - 1; m >= 0; m-- {
+		mask := net.CIDRMask(m, bits)
+		entry := getIPNet(table, &net.IPNet{IP: prefix.IP.Mask(mask), Mask: mask})
+		if entry != nil && !entry.excludesPrefix(prefix) {
+			return entry
+		}
+	}
+	return nil
+}
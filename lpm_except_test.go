@@ -0,0 +1,158 @@
+package golpm
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func lookupValue(table LPMTable, ip string) interface{} {
+	entry := table.Lookup(ip)
+	if entry == nil {
+		return nil
+	}
+	return entry.Entry
+}
+
+func TestRadixTable_AddExcept(t *testing.T) {
+	Convey("Fall through excluded prefixes", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		So(table.Add("10.0.0.0/8", "private"), ShouldBeNil)
+		So(table.AddExcept("10.1.0.0/16", []string{"10.1.2.0/24", "10.1.3.128/25"}, "site"), ShouldBeNil)
+		So(table.AddExcept("172.16.0.0/12", []string{"172.16.0.0/16"}, "other"), ShouldBeNil)
+
+		So(lookupValue(table, "10.1.1.1"), ShouldEqual, "site")
+		So(lookupValue(table, "10.1.2.1"), ShouldEqual, "private")
+		So(lookupValue(table, "10.1.3.127"), ShouldEqual, "site")
+		So(lookupValue(table, "10.1.3.128"), ShouldEqual, "private")
+		So(lookupValue(table, "172.17.0.1"), ShouldEqual, "other")
+		So(lookupValue(table, "172.16.0.1"), ShouldBeNil)
+
+		Convey("Longer prefixes inside an exclusion still match", func() {
+			So(table.Add("10.1.2.0/25", "inner"), ShouldBeNil)
+			So(lookupValue(table, "10.1.2.1"), ShouldEqual, "inner")
+			So(lookupValue(table, "10.1.2.129"), ShouldEqual, "private")
+		})
+
+		Convey("Exclude from the default route", func() {
+			So(table.AddExcept("0.0.0.0/0", []string{"192.168.0.0/16"}, "default"), ShouldBeNil)
+			So(lookupValue(table, "8.8.8.8"), ShouldEqual, "default")
+			So(lookupValue(table, "192.168.1.1"), ShouldBeNil)
+			So(lookupValue(table, "172.16.0.1"), ShouldEqual, "default")
+		})
+
+		Convey("Expose exclusions", func() {
+			entry := table.Get("10.1.0.0/16")
+			So(cidrStrings(entry.Except), ShouldResemble, []string{"10.1.2.0/24", "10.1.3.128/25"})
+			So(cidrStrings(table.Show()[16][0].Except), ShouldResemble, []string{"10.1.2.0/24", "10.1.3.128/25"})
+			So(table.Get("10.0.0.0/8").Except, ShouldBeNil)
+		})
+
+		Convey("Replace an entry and its exclusions", func() {
+			So(table.Add("10.1.0.0/16", "site"), ShouldBeNil)
+			So(lookupValue(table, "10.1.2.1"), ShouldEqual, "site")
+		})
+	})
+
+	Convey("Reject exclusions outside the prefix", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		So(table.AddExcept("10.1.0.0/16", []string{"10.2.0.0/24"}, "site"), ShouldBeError)
+		So(table.AddExcept("10.1.0.0/16", []string{"10.0.0.0/8"}, "site"), ShouldBeError)
+		So(table.AddExcept("10.1.0.0/16", []string{"2001:db8::/32"}, "site"), ShouldBeError)
+		So(table.AddExcept("10.1.0.0/16", []string{"10.1.0.0/33"}, "site"), ShouldBeError)
+		So(len(table.Show()), ShouldEqual, 0)
+	})
+
+	Convey("Exclude ipv6 prefixes in a dual-family table", t, func() {
+		table := NewDualLPMTable(ArchRadix)
+		So(table.Add("2001:db8::/32", "doc"), ShouldBeNil)
+		So(table.AddExcept("2001:db8:1::/48", []string{"2001:db8:1:ff::/64"}, "site"), ShouldBeNil)
+		So(table.AddExcept("10.0.0.0/8", []string{"10.0.0.0/9"}, "v4"), ShouldBeNil)
+		So(lookupValue(table, "2001:db8:1::1"), ShouldEqual, "site")
+		So(lookupValue(table, "2001:db8:1:ff::1"), ShouldEqual, "doc")
+		So(lookupValue(table, "10.0.0.1"), ShouldBeNil)
+		So(lookupValue(table, "10.200.0.1"), ShouldEqual, "v4")
+	})
+}
+
+func TestExcept_Rewrite(t *testing.T) {
+	Convey("Keep exclusions in diffs", t, func() {
+		a := NewRadixLPMTable(false)
+		b := NewRadixLPMTable(false).(*RadixTable)
+		a.Add("10.0.0.0/8", "x")
+		b.AddExcept("10.0.0.0/8", []string{"10.1.0.0/16"}, "x")
+
+		diff := Diff(a, b, nil)
+		So(len(diff.Changed), ShouldEqual, 1)
+		changes := SemanticDiff(a, b, nil)
+		So(len(changes), ShouldEqual, 1)
+		So(changes[0].Start.String(), ShouldEqual, "10.1.0.0")
+		So(changes[0].End.String(), ShouldEqual, "10.1.255.255")
+		So(changes[0].New, ShouldBeNil)
+	})
+
+	Convey("Write exclusions to a MaxMind DB", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		table.Add("10.0.0.0/8", "private")
+		table.AddExcept("10.1.0.0/16", []string{"10.1.2.0/24"}, "site")
+		table.AddExcept("172.16.0.0/12", []string{"172.16.0.0/16"}, "other")
+
+		var buf bytes.Buffer
+		So(WriteMMDB(&buf, table, nil), ShouldBeNil)
+		loaded := NewRadixLPMTable(false)
+		_, err := LoadMMDB(buf.Bytes(), loaded)
+		So(err, ShouldBeNil)
+		for _, ip := range []string{"10.1.1.1", "10.1.2.1", "10.2.0.1", "172.16.0.1", "172.17.0.1"} {
+			So(lookupValue(loaded, ip), ShouldEqual, lookupValue(table, ip))
+		}
+	})
+
+	Convey("Aggregate random tables with exclusions", t, func() {
+		rnd := rand.New(rand.NewSource(3))
+		randomPrefix := func(minLen int) *net.IPNet {
+			maskLen := minLen + rnd.Intn(33-minLen)
+			ip := net.IPv4(10, 0, byte(rnd.Intn(4)), byte(rnd.Intn(256)))
+			return &net.IPNet{IP: ip.Mask(net.CIDRMask(maskLen, 32)), Mask: net.CIDRMask(maskLen, 32)}
+		}
+		for round := 0; round < 20; round++ {
+			table := NewRadixLPMTable(false).(*RadixTable)
+			for i := 0; i < 40; i++ {
+				prefix := randomPrefix(16)
+				var except []*net.IPNet
+				for j := rnd.Intn(3); j > 0; j-- {
+					maskSize, _ := prefix.Mask.Size()
+					sub := randomPrefix(maskSize)
+					subSize, _ := sub.Mask.Size()
+					copy(sub.IP, prefix.IP.Mask(prefix.Mask))
+					sub.IP = sub.IP.Mask(sub.Mask)
+					if prefix.Contains(sub.IP) && subSize >= maskSize {
+						except = append(except, sub)
+					}
+				}
+				So(table.AddIPNetExcept(prefix, except, rnd.Intn(3)), ShouldBeNil)
+			}
+			if round%2 == 0 {
+				table.AddExcept("0.0.0.0/0", []string{"10.0.2.0/24"}, 0)
+			}
+
+			aggregated := table.Aggregate(nil)
+			merged := table.MergeSiblings(nil)
+			var buf bytes.Buffer
+			So(WriteMMDB(&buf, table, nil), ShouldBeNil)
+			loaded := NewRadixLPMTable(false)
+			_, err := LoadMMDB(buf.Bytes(), loaded)
+			So(err, ShouldBeNil)
+			for i := 0; i < 1<<11; i++ {
+				ip := fmt.Sprintf("10.%d.%d.%d", i>>10, i>>8&3, rnd.Intn(256))
+				want := lookupValue(table, ip)
+				So(lookupValue(aggregated, ip), ShouldEqual, want)
+				So(lookupValue(merged, ip), ShouldEqual, want)
+				So(lookupValue(loaded, ip), ShouldEqual, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,265 @@
+package golpm
+
+import (
+	"fmt"
+	"net"
+)
+
+// IPSet A set of ipv4 and ipv6 addresses. Each family is stored as a
+// minimal list of prefixes in a radix table.
+type IPSet struct {
+	v4 *RadixTable
+	v6 *RadixTable
+}
+
+// NewIPSet Create a set holding the given prefixes
+func NewIPSet(prefixes ...string) (*IPSet, error) {
+	set := &IPSet{
+		v4: NewRadixLPMTable(false).(*RadixTable),
+		v6: NewRadixLPMTable(true).(*RadixTable),
+	}
+	for _, prefix := range prefixes {
+		if err := set.Add(prefix); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+func (s *IPSet) tableFor(ip net.IP) *RadixTable {
+	if ip.To4() != nil {
+		return s.v4
+	}
+	return s.v6
+}
+
+func (s *IPSet) Add(prefix string) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return s.AddIPNet(ipNet)
+}
+
+// AddIPNet Add the addresses of prefix to the set. Only the prefixes of
+// the set inside prefix or merging with it are changed.
+func (s *IPSet) AddIPNet(prefix *net.IPNet) error {
+	table := s.tableFor(prefix.IP)
+	prefix, err := setPrefix(table, prefix)
+	if err != nil {
+		return err
+	}
+	if tableCoversPrefix(table, prefix) {
+		return nil
+	}
+	if err = deleteWithin(table, prefix); err != nil {
+		return err
+	}
+	// a prefix whose sibling is in the set merges with it into the parent
+	for maskSize, bits := prefix.Mask.Size(); maskSize > 0; maskSize-- {
+		sibling := siblingPrefix(prefix)
+		if table.GetIPNet(sibling) == nil {
+			break
+		}
+		if err = table.DeleteIPNet(sibling); err != nil {
+			return err
+		}
+		mask := net.CIDRMask(maskSize-1, bits)
+		prefix = &net.IPNet{IP: prefix.IP.Mask(mask), Mask: mask}
+	}
+	return table.AddIPNet(prefix, struct{}{})
+}
+
+func (s *IPSet) Remove(prefix string) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return s.RemoveIPNet(ipNet)
+}
+
+// RemoveIPNet Remove the addresses of prefix from the set. Only the
+// prefixes of the set inside prefix or covering it are changed.
+func (s *IPSet) RemoveIPNet(prefix *net.IPNet) error {
+	table := s.tableFor(prefix.IP)
+	prefix, err := setPrefix(table, prefix)
+	if err != nil {
+		return err
+	}
+	maskSize, _ := prefix.Mask.Size()
+	covering := table.LookupIP(prefix.IP)
+	coveringSize := maskSize
+	if covering != nil {
+		coveringSize, _ = covering.Prefix.Mask.Size()
+	}
+	if coveringSize >= maskSize {
+		return deleteWithin(table, prefix)
+	}
+
+	// split the covering prefix, keeping the siblings along the path down
+	if err = table.DeleteIPNet(covering.Prefix); err != nil {
+		return err
+	}
+	for ; maskSize > coveringSize; maskSize-- {
+		if err = table.AddIPNet(siblingPrefix(prefix), struct{}{}); err != nil {
+			return err
+		}
+		mask := net.CIDRMask(maskSize-1, len(prefix.Mask)*8)
+		prefix = &net.IPNet{IP: prefix.IP.Mask(mask), Mask: mask}
+	}
+	return nil
+}
+
+func (s *IPSet) Contains(ip string) bool {
+	ipp := net.ParseIP(ip)
+	if ipp == nil {
+		return false
+	}
+	return s.ContainsIP(ipp)
+}
+
+// ContainsIP Report whether ip is in the set
+func (s *IPSet) ContainsIP(ip net.IP) bool {
+	return s.tableFor(ip).LookupIP(ip) != nil
+}
+
+// Union Return the addresses in s or o
+func (s *IPSet) Union(o *IPSet) (*IPSet, error) {
+	return s.combine(o, func(a, b []ipInterval, ipLen int) []ipInterval {
+		all := make([]ipInterval, 0, len(a)+len(b))
+		for len(a) > 0 || len(b) > 0 {
+			if len(b) == 0 || len(a) > 0 && compareIP(a[0].start, b[0].start) <= 0 {
+				all, a = append(all, a[0]), a[1:]
+			} else {
+				all, b = append(all, b[0]), b[1:]
+			}
+		}
+		return mergeIntervals(all)
+	})
+}
+
+// Intersect Return the addresses in both s and o
+func (s *IPSet) Intersect(o *IPSet) (*IPSet, error) {
+	return s.combine(o, func(a, b []ipInterval, ipLen int) []ipInterval {
+		return intersectIntervals(a, b)
+	})
+}
+
+// Difference Return the addresses in s but not in o
+func (s *IPSet) Difference(o *IPSet) (*IPSet, error) {
+	return s.combine(o, func(a, b []ipInterval, ipLen int) []ipInterval {
+		return intersectIntervals(a, complementIntervals(b, ipLen))
+	})
+}
+
+// Complement Return the addresses of both families not in s
+func (s *IPSet) Complement() (*IPSet, error) {
+	return s.combine(s, func(a, _ []ipInterval, ipLen int) []ipInterval {
+		return complementIntervals(a, ipLen)
+	})
+}
+
+// Overlaps Report whether s and o have an address in common
+func (s *IPSet) Overlaps(o *IPSet) bool {
+	return len(intersectIntervals(tableIntervals(s.v4), tableIntervals(o.v4))) > 0 ||
+		len(intersectIntervals(tableIntervals(s.v6), tableIntervals(o.v6))) > 0
+}
+
+// CIDRs Return the minimal list of prefixes of the set, ipv4 ones first
+func (s *IPSet) CIDRs() []*net.IPNet {
+	var prefixes []*net.IPNet
+	for _, table := range []*RadixTable{s.v4, s.v6} {
+		table.Walk(func(entry *Entry) bool {
+			prefixes = append(prefixes, entry.Prefix)
+			return true
+		})
+	}
+	return prefixes
+}
+
+func (s *IPSet) combine(o *IPSet, op func(a, b []ipInterval, ipLen int) []ipInterval) (*IPSet, error) {
+	set, _ := NewIPSet()
+	if err := set.replace(set.v4, op(tableIntervals(s.v4), tableIntervals(o.v4), net.IPv4len)); err != nil {
+		return nil, err
+	}
+	if err := set.replace(set.v6, op(tableIntervals(s.v6), tableIntervals(o.v6), net.IPv6len)); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// replace Reset table to the minimal prefixes covering intervals
+func (s *IPSet) replace(table *RadixTable, intervals []ipInterval) error {
+	fresh := table.emptyLike()
+	for _, interval := range intervals {
+		prefixes, err := rangeToCIDRs(interval.start, interval.end)
+		if err != nil {
+			return err
+		}
+		for _, prefix := range prefixes {
+			if err = fresh.AddIPNet(prefix, struct{}{}); err != nil {
+				return err
+			}
+		}
+	}
+	*table = *fresh
+	return nil
+}
+
+// setPrefix Return prefix with its address in the family of table and its
+// host bits cleared
+func setPrefix(table *RadixTable, prefix *net.IPNet) (*net.IPNet, error) {
+	ip := prefix.IP.To16()
+	if table.ipBytesLen == net.IPv4len {
+		ip = prefix.IP.To4()
+	}
+	if len(prefix.Mask) != len(ip) {
+		return nil, fmt.Errorf("mask of %s does not match its address", prefix)
+	}
+	return &net.IPNet{IP: ip.Mask(prefix.Mask), Mask: prefix.Mask}, nil
+}
+
+// siblingPrefix Return the prefix of the same length differing from prefix
+// in its last bit
+func siblingPrefix(prefix *net.IPNet) *net.IPNet {
+	maskSize, _ := prefix.Mask.Size()
+	ip := append(net.IP(nil), prefix.IP...)
+	ip[(maskSize-1)/8] ^= 0x80 >> ((maskSize - 1) % 8)
+	return &net.IPNet{IP: ip, Mask: prefix.Mask}
+}
+
+// deleteWithin Delete prefix and its sub-prefixes from table
+func deleteWithin(table *RadixTable, prefix *net.IPNet) error {
+	var inside []*net.IPNet
+	table.walkWithin(prefix, func(entry *Entry) bool {
+		inside = append(inside, entry.Prefix)
+		return true
+	})
+	for _, p := range inside {
+		if err := table.DeleteIPNet(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableIntervals Return the merged ranges covered by the prefixes of table
+func tableIntervals(table *RadixTable) []ipInterval {
+	var intervals []ipInterval
+	table.Walk(func(entry *Entry) bool {
+		intervals = append(intervals, prefixInterval(entry.Prefix))
+		return true
+	})
+	return mergeIntervals(intervals)
+}
+
+// tableCoversPrefix Report whether a prefix of table contains prefix
+func tableCoversPrefix(table *RadixTable, prefix *net.IPNet) bool {
+	entry := table.LookupIP(prefix.IP)
+	if entry == nil {
+		return false
+	}
+	covering, _ := entry.Prefix.Mask.Size()
+	maskSize, _ := prefix.Mask.Size()
+	return covering <= maskSize
+}
@@ -0,0 +1,168 @@
+package golpm
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func setCIDRs(set *IPSet) []string {
+	return cidrStrings(set.CIDRs())
+}
+
+func TestIPSet(t *testing.T) {
+	Convey("Build a minimal set", t, func() {
+		set, err := NewIPSet("10.0.0.0/25", "10.0.0.128/25", "10.0.1.0/24", "10.0.0.7/32", "2001:db8::/33", "2001:db8:8000::/33")
+		So(err, ShouldBeNil)
+		So(setCIDRs(set), ShouldResemble, []string{"10.0.0.0/23", "2001:db8::/32"})
+		So(set.Contains("10.0.1.255"), ShouldBeTrue)
+		So(set.Contains("10.0.2.0"), ShouldBeFalse)
+		So(set.Contains("2001:db8:ffff::1"), ShouldBeTrue)
+		So(set.Contains("bad"), ShouldBeFalse)
+
+		_, err = NewIPSet("10.0.0.0/33")
+		So(err, ShouldBeError)
+	})
+
+	Convey("Remove prefixes from a set", t, func() {
+		set, _ := NewIPSet("10.0.0.0/8")
+		So(set.Remove("10.0.0.0/9"), ShouldBeNil)
+		So(set.Remove("10.255.255.255/32"), ShouldBeNil)
+		So(set.Contains("10.0.0.1"), ShouldBeFalse)
+		So(set.Contains("10.128.0.1"), ShouldBeTrue)
+		So(set.Contains("10.255.255.255"), ShouldBeFalse)
+		So(len(set.CIDRs()), ShouldEqual, 23)
+
+		set, _ = NewIPSet("10.0.1.0/24", "10.0.3.0/24")
+		So(set.Remove("10.0.0.0/16"), ShouldBeNil)
+		So(setCIDRs(set), ShouldBeEmpty)
+	})
+
+	Convey("Add and remove in place like the set algebra", t, func() {
+		rnd := rand.New(rand.NewSource(5))
+		for _, bits := range []int{32, 128} {
+			set, _ := NewIPSet()
+			want, _ := NewIPSet()
+			for i := 0; i < 2000; i++ {
+				ip := make(net.IP, bits/8)
+				ip[0], ip[1], ip[2] = 10, byte(rnd.Intn(4)), byte(rnd.Intn(256))
+				maskLen := 14 + rnd.Intn(12)
+				prefix := &net.IPNet{IP: ip.Mask(net.CIDRMask(maskLen, bits)), Mask: net.CIDRMask(maskLen, bits)}
+				other, err := NewIPSet()
+				So(other.AddIPNet(prefix), ShouldBeNil)
+				if rnd.Intn(3) == 0 {
+					So(set.RemoveIPNet(prefix), ShouldBeNil)
+					want, err = want.Difference(other)
+					So(err, ShouldBeNil)
+				} else {
+					So(set.AddIPNet(prefix), ShouldBeNil)
+					want, err = want.Union(other)
+					So(err, ShouldBeNil)
+				}
+				So(setCIDRs(set), ShouldResemble, setCIDRs(want))
+			}
+		}
+	})
+
+	Convey("Combine sets", t, func() {
+		allow, _ := NewIPSet("10.0.0.0/8", "192.168.0.0/16", "2001:db8::/32")
+		deny, _ := NewIPSet("10.1.0.0/16", "192.168.0.0/16", "172.16.0.0/12", "2001:db8:1::/48")
+
+		difference, err := allow.Difference(deny)
+		So(err, ShouldBeNil)
+		So(setCIDRs(difference), ShouldResemble, []string{
+			"10.0.0.0/16", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13", "10.16.0.0/12", "10.32.0.0/11",
+			"10.64.0.0/10", "10.128.0.0/9",
+			"2001:db8::/48", "2001:db8:2::/47", "2001:db8:4::/46", "2001:db8:8::/45", "2001:db8:10::/44",
+			"2001:db8:20::/43", "2001:db8:40::/42", "2001:db8:80::/41", "2001:db8:100::/40",
+			"2001:db8:200::/39", "2001:db8:400::/38", "2001:db8:800::/37", "2001:db8:1000::/36",
+			"2001:db8:2000::/35", "2001:db8:4000::/34", "2001:db8:8000::/33",
+		})
+		intersect, err := allow.Intersect(deny)
+		So(err, ShouldBeNil)
+		So(setCIDRs(intersect), ShouldResemble, []string{"10.1.0.0/16", "192.168.0.0/16", "2001:db8:1::/48"})
+		union, err := allow.Union(deny)
+		So(err, ShouldBeNil)
+		So(setCIDRs(union), ShouldResemble, []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "2001:db8::/32"})
+		So(allow.Overlaps(deny), ShouldBeTrue)
+
+		other, _ := NewIPSet("11.0.0.0/8")
+		So(allow.Overlaps(other), ShouldBeFalse)
+	})
+
+	Convey("Complement sets", t, func() {
+		empty, _ := NewIPSet()
+		full, err := empty.Complement()
+		So(err, ShouldBeNil)
+		So(setCIDRs(full), ShouldResemble, []string{"0.0.0.0/0", "::/0"})
+		full, err = full.Complement()
+		So(err, ShouldBeNil)
+		So(setCIDRs(full), ShouldBeEmpty)
+
+		set, _ := NewIPSet("128.0.0.0/1", "::/1")
+		complement, err := set.Complement()
+		So(err, ShouldBeNil)
+		So(setCIDRs(complement), ShouldResemble, []string{"0.0.0.0/1", "8000::/1"})
+	})
+
+	Convey("Check set algebra against random address samples", t, func() {
+		rnd := rand.New(rand.NewSource(2))
+		randomSet := func() *IPSet {
+			set, _ := NewIPSet()
+			for i := 0; i < 20; i++ {
+				maskLen := 12 + rnd.Intn(13)
+				ip := net.IPv4(10, byte(rnd.Intn(64)), byte(rnd.Intn(256)), 0).To4()
+				set.AddIPNet(&net.IPNet{IP: ip.Mask(net.CIDRMask(maskLen, 32)), Mask: net.CIDRMask(maskLen, 32)})
+			}
+			return set
+		}
+		for round := 0; round < 10; round++ {
+			a, b := randomSet(), randomSet()
+			union, err := a.Union(b)
+			So(err, ShouldBeNil)
+			intersect, err := a.Intersect(b)
+			So(err, ShouldBeNil)
+			difference, err := a.Difference(b)
+			So(err, ShouldBeNil)
+			complement, err := a.Complement()
+			So(err, ShouldBeNil)
+			for i := 0; i < 2000; i++ {
+				ip := fmt.Sprintf("10.%d.%d.1", rnd.Intn(64), rnd.Intn(256))
+				inA, inB := a.Contains(ip), b.Contains(ip)
+				So(union.Contains(ip), ShouldEqual, inA || inB)
+				So(intersect.Contains(ip), ShouldEqual, inA && inB)
+				So(difference.Contains(ip), ShouldEqual, inA && !inB)
+				So(complement.Contains(ip), ShouldEqual, !inA)
+			}
+		}
+	})
+}
+
+// BenchmarkIPSet_AddIPNet Add 128k /25 prefixes one at a time, every other
+// one first so that the second half merges with them
+func BenchmarkIPSet_AddIPNet(b *testing.B) {
+	const count = 1 << 17
+	prefixes := make([]*net.IPNet, 0, count)
+	for _, half := range []int{0, 1} {
+		for i := half; i < count; i += 2 {
+			ip := net.IPv4(10, byte(i>>9), byte(i>>1), byte(i&1)<<7).To4()
+			prefixes = append(prefixes, &net.IPNet{IP: ip, Mask: net.CIDRMask(25, 32)})
+		}
+	}
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		set, _ := NewIPSet()
+		for _, prefix := range prefixes {
+			if err := set.AddIPNet(prefix); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if cidrs := set.CIDRs(); len(cidrs) != 1 {
+			b.Fatalf("got %d prefixes, want 10.0.0.0/8", len(cidrs))
+		}
+	}
+}
@@ -0,0 +1,832 @@
+package golpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// MaxMind DB data types, see https://maxmind.github.io/MaxMind-DB/
+const (
+	mmdbExtended  = 0
+	mmdbPointer   = 1
+	mmdbString    = 2
+	mmdbDouble    = 3
+	mmdbBytes     = 4
+	mmdbUint16    = 5
+	mmdbUint32    = 6
+	mmdbMap       = 7
+	mmdbInt32     = 8
+	mmdbUint64    = 9
+	mmdbUint128   = 10
+	mmdbArray     = 11
+	mmdbContainer = 12
+	mmdbEndMarker = 13
+	mmdbBool      = 14
+	mmdbFloat     = 15
+
+	mmdbDataSeparatorLen = 16
+)
+
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+var errMMDBCorrupt = errors.New("corrupt mmdb data")
+
+// MMDBMetadata The metadata section of a MaxMind DB file
+type MMDBMetadata struct {
+	NodeCount                uint32
+	RecordSize               uint16
+	IPVersion                uint16
+	DatabaseType             string
+	Languages                []string
+	BinaryFormatMajorVersion uint16
+	BinaryFormatMinorVersion uint16
+	BuildEpoch               uint64
+	Description              map[string]string
+}
+
+// ReadMMDB Load a MaxMind DB read from r into table, see LoadMMDB
+func ReadMMDB(r io.Reader, table LPMTable) (*MMDBMetadata, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return LoadMMDB(data, table)
+}
+
+// LoadMMDB Load every network of a MaxMind DB into table with its decoded
+// record as entry. Maps are decoded as map[string]interface{}, arrays as
+// []interface{}, unsigned integers as uint64, int32 as int and uint128 as
+// *big.Int. An ipv4 table receives the ipv4 subtree of an ipv6 database,
+// and a DualTable splits it at ::/96 between its V4 and V6 tables.
+// Subtrees aliased into the ipv4 subtree are loaded only once.
+func LoadMMDB(data []byte, table LPMTable) (*MMDBMetadata, error) {
+	metaStart := bytes.LastIndex(data, mmdbMetadataMarker)
+	if metaStart < 0 {
+		return nil, errors.New("mmdb metadata not found")
+	}
+	metaStart += len(mmdbMetadataMarker)
+	metaDecoder := mmdbDecoder{data: data[metaStart:]}
+	rawMeta, _, err := metaDecoder.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := parseMMDBMetadata(rawMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	searchSize := int(meta.NodeCount) * int(meta.RecordSize) / 4
+	if searchSize+mmdbDataSeparatorLen > metaStart-len(mmdbMetadataMarker) {
+		return nil, errMMDBCorrupt
+	}
+	loader := &mmdbLoader{
+		meta:   meta,
+		tree:   data[:searchSize],
+		data:   mmdbDecoder{data: data[searchSize+mmdbDataSeparatorLen : metaStart-len(mmdbMetadataMarker)]},
+		table:  table,
+		cache:  make(map[int]interface{}),
+		seen:   make([]uint64, (meta.NodeCount+63)/64),
+		ipBits: 128,
+	}
+	if meta.IPVersion == 4 {
+		loader.ipBits = 32
+	}
+
+	ipBytesLen := tableIPBytesLen(table)
+	dual, _ := table.(*DualTable)
+	var ip [net.IPv6len]byte
+	switch {
+	case dual != nil && meta.IPVersion == 4:
+		loader.table = dual.V4
+		err = loader.walk(0, ip[:net.IPv4len], 0)
+	case dual != nil:
+		// the ipv4 subtree goes to the ipv4 table, the rest to the ipv6 one
+		loader.table, loader.v4 = dual.V6, dual.V4
+		err = loader.walk(0, ip[:], 0)
+	case ipBytesLen == net.IPv6len && meta.IPVersion == 4:
+		return nil, errors.New("load ipv4 mmdb to ipv6 table")
+	case ipBytesLen == net.IPv4len && meta.IPVersion == 6:
+		// the ipv4 subtree starts at ::/96
+		node := uint32(0)
+		for i := 0; i < 96 && node < meta.NodeCount; i++ {
+			node = loader.record(node, 0)
+		}
+		loader.ipBits = 32
+		err = loader.walk(node, ip[:net.IPv4len], 0)
+	default:
+		err = loader.walk(0, ip[:loader.ipBits/8], 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+func parseMMDBMetadata(raw interface{}) (*MMDBMetadata, error) {
+	fields, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errMMDBCorrupt
+	}
+	meta := &MMDBMetadata{}
+	number := func(key string) uint64 {
+		value, _ := fields[key].(uint64)
+		return value
+	}
+	meta.NodeCount = uint32(number("node_count"))
+	meta.RecordSize = uint16(number("record_size"))
+	meta.IPVersion = uint16(number("ip_version"))
+	meta.BinaryFormatMajorVersion = uint16(number("binary_format_major_version"))
+	meta.BinaryFormatMinorVersion = uint16(number("binary_format_minor_version"))
+	meta.BuildEpoch = number("build_epoch")
+	meta.DatabaseType, _ = fields["database_type"].(string)
+	if languages, ok := fields["languages"].([]interface{}); ok {
+		for _, language := range languages {
+			if s, ok := language.(string); ok {
+				meta.Languages = append(meta.Languages, s)
+			}
+		}
+	}
+	if description, ok := fields["description"].(map[string]interface{}); ok {
+		meta.Description = make(map[string]string, len(description))
+		for k, v := range description {
+			if s, ok := v.(string); ok {
+				meta.Description[k] = s
+			}
+		}
+	}
+
+	if meta.RecordSize != 24 && meta.RecordSize != 28 && meta.RecordSize != 32 {
+		return nil, fmt.Errorf("unsupported mmdb record size %d", meta.RecordSize)
+	}
+	if meta.IPVersion != 4 && meta.IPVersion != 6 {
+		return nil, fmt.Errorf("unsupported mmdb ip version %d", meta.IPVersion)
+	}
+	return meta, nil
+}
+
+type mmdbLoader struct {
+	meta   *MMDBMetadata
+	tree   []byte
+	data   mmdbDecoder
+	table  LPMTable
+	v4     LPMTable            // takes the ::/96 subtree when loading into a DualTable
+	cache  map[int]interface{} // decoded records by data offset
+	seen   []uint64            // visited nodes, to skip aliased subtrees
+	ipBits int
+}
+
+func (ml *mmdbLoader) record(node uint32, bit int) uint32 {
+	nodeBytes := int(ml.meta.RecordSize) / 4
+	b := ml.tree[int(node)*nodeBytes : int(node+1)*nodeBytes]
+	switch ml.meta.RecordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	case 28:
+		if bit == 0 {
+			return uint32(b[3]&0xf0)<<20 | uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+		}
+		return uint32(b[3]&0x0f)<<24 | uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6])
+	default:
+		return binary.BigEndian.Uint32(b[bit*4:])
+	}
+}
+
+// isZeroIP Report whether every byte of ip is zero
+func isZeroIP(ip []byte) bool {
+	for _, b := range ip {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (ml *mmdbLoader) walk(node uint32, ip []byte, depth int) error {
+	nodeCount := ml.meta.NodeCount
+	if node == nodeCount {
+		return nil
+	}
+	v4Subtree := ml.v4 != nil && depth <= 96 && isZeroIP(ip[:12])
+	if v4Subtree && depth == 96 {
+		v4 := *ml
+		v4.table, v4.v4, v4.ipBits = ml.v4, nil, 32
+		var ip4 [net.IPv4len]byte
+		return v4.walk(node, ip4[:], 0)
+	}
+	if node > nodeCount {
+		offset := int(node-nodeCount) - mmdbDataSeparatorLen
+		if offset < 0 {
+			return errMMDBCorrupt
+		}
+		entry, ok := ml.cache[offset]
+		if !ok {
+			var err error
+			entry, _, err = ml.data.decode(offset)
+			if err != nil {
+				return err
+			}
+			ml.cache[offset] = entry
+		}
+		prefix := &net.IPNet{
+			IP:   append(net.IP(nil), ip...),
+			Mask: net.CIDRMask(depth, len(ip)*8),
+		}
+		if len(ip) == net.IPv6len && prefix.IP.To4() != nil {
+			// ipv4-mapped networks are an alias of the ipv4 subtree
+			return nil
+		}
+		if v4Subtree {
+			// a network covering ::/96 covers the whole ipv4 table as well
+			if err := ml.v4.AddIPNet(&net.IPNet{IP: make(net.IP, net.IPv4len), Mask: make(net.IPMask, net.IPv4len)}, entry); err != nil {
+				return err
+			}
+		}
+		return ml.table.AddIPNet(prefix, entry)
+	}
+	if depth >= ml.ipBits {
+		return errMMDBCorrupt
+	}
+	if ml.seen[node/64]&(1<<(node%64)) != 0 {
+		return nil
+	}
+	ml.seen[node/64] |= 1 << (node % 64)
+
+	for bit := 0; bit < 2; bit++ {
+		if bit == 1 {
+			ip[depth/8] |= 0x80 >> (depth % 8)
+		}
+		if err := ml.walk(ml.record(node, bit), ip, depth+1); err != nil {
+			return err
+		}
+	}
+	ip[depth/8] &^= 0x80 >> (depth % 8)
+	return nil
+}
+
+type mmdbDecoder struct {
+	data   []byte
+	values int // values left to decode, for pointers fanning out
+}
+
+func (md *mmdbDecoder) ctrl(offset int) (typ int, size int, next int, err error) {
+	if offset >= len(md.data) {
+		return 0, 0, 0, errMMDBCorrupt
+	}
+	ctrl := md.data[offset]
+	offset++
+	typ = int(ctrl >> 5)
+	if typ == mmdbPointer {
+		return typ, int(ctrl), offset, nil
+	}
+	if typ == mmdbExtended {
+		if offset >= len(md.data) {
+			return 0, 0, 0, errMMDBCorrupt
+		}
+		typ = int(md.data[offset]) + 7
+		offset++
+	}
+
+	size = int(ctrl & 0x1f)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > len(md.data) {
+			return 0, 0, 0, errMMDBCorrupt
+		}
+		n := 0
+		for _, b := range md.data[offset : offset+extra] {
+			n = n<<8 | int(b)
+		}
+		switch size {
+		case 29:
+			size = 29 + n
+		case 30:
+			size = 285 + n
+		default:
+			size = 65821 + n
+		}
+		offset += extra
+	}
+	return typ, size, offset, nil
+}
+
+func (md *mmdbDecoder) uint(offset, size int) (uint64, error) {
+	if offset+size > len(md.data) || size > 8 {
+		return 0, errMMDBCorrupt
+	}
+	var n uint64
+	for _, b := range md.data[offset : offset+size] {
+		n = n<<8 | uint64(b)
+	}
+	return n, nil
+}
+
+// mmdbMaxDepth The deepest nesting of maps and arrays decoded, and
+// mmdbMaxValues the most values decoded for a value, pointers letting
+// a small section expand to exponentially many values
+const (
+	mmdbMaxDepth  = 64
+	mmdbMaxValues = 1 << 20
+)
+
+// decode Decode the value at offset and return it with the offset following it
+func (md *mmdbDecoder) decode(offset int) (interface{}, int, error) {
+	md.values = mmdbMaxValues
+	return md.decodeValue(offset, 0, false)
+}
+
+// decodeValue Decode the value at offset nested in depth maps and arrays.
+// A pointer must not resolve to another pointer.
+func (md *mmdbDecoder) decodeValue(offset, depth int, pointed bool) (interface{}, int, error) {
+	if md.values--; depth > mmdbMaxDepth || md.values < 0 {
+		return nil, 0, errMMDBCorrupt
+	}
+	typ, size, offset, err := md.ctrl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if typ == mmdbPointer && pointed {
+		return nil, 0, errMMDBCorrupt
+	}
+
+	if typ == mmdbPointer {
+		ctrl := size
+		ss := (ctrl >> 3) & 0x3
+		pointerSize := ss + 1
+		if offset+pointerSize > len(md.data) {
+			return nil, 0, errMMDBCorrupt
+		}
+		pointer := 0
+		if ss != 3 {
+			pointer = ctrl & 0x7
+		}
+		for _, b := range md.data[offset : offset+pointerSize] {
+			pointer = pointer<<8 | int(b)
+		}
+		switch ss {
+		case 1:
+			pointer += 2048
+		case 2:
+			pointer += 526336
+		}
+		value, _, err := md.decodeValue(pointer, depth, true)
+		return value, offset + pointerSize, err
+	}
+
+	// map and array sizes count elements, each taking at least a byte
+	if typ != mmdbBool && offset+size > len(md.data) {
+		return nil, 0, errMMDBCorrupt
+	}
+	switch typ {
+	case mmdbString:
+		return string(md.data[offset : offset+size]), offset + size, nil
+	case mmdbBytes:
+		return append([]byte(nil), md.data[offset:offset+size]...), offset + size, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(md.data[offset:])), offset + size, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(md.data[offset:])), offset + size, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		n, err := md.uint(offset, size)
+		return n, offset + size, err
+	case mmdbInt32:
+		n, err := md.uint(offset, size)
+		if size > 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return int(int32(uint32(n))), offset + size, err
+	case mmdbUint128:
+		if size > 16 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return new(big.Int).SetBytes(md.data[offset : offset+size]), offset + size, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := 0; i < size; i++ {
+			key, next, err := md.decodeValue(offset, depth+1, false)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errMMDBCorrupt
+			}
+			m[k], offset, err = md.decodeValue(next, depth+1, false)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]interface{}, size)
+		for i := range a {
+			a[i], offset, err = md.decodeValue(offset, depth+1, false)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return a, offset, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported mmdb data type %d", typ)
+}
+
+// MMDBOptions Options of WriteMMDB
+type MMDBOptions struct {
+	DatabaseType string
+	Description  map[string]string
+	Languages    []string
+	// IPVersion is 4 or 6, it is derived from the table when zero
+	IPVersion int
+	// RecordSize is 24, 28 or 32, the smallest fitting size is used when zero
+	RecordSize int
+	// BuildEpoch defaults to the current time
+	BuildEpoch uint64
+}
+
+// mmdbNoRoute The entry of an excluded prefix without route to fall through to
+type mmdbNoRoute struct{}
+
+type mmdbNode struct {
+	children [2]*mmdbNode
+	data     int // offset in data section, -1 for none
+	index    uint32
+}
+
+// WriteMMDB Write table as a MaxMind DB. Entries must be strings, []byte,
+// booleans, integers, floats, *big.Int or maps with string keys and slices
+// of those. Overlapping prefixes are flattened so that a reader gets the
+// same longest match result as table. IPv4 networks written to an ipv6
+// database, as for a DualTable, are placed in the ::/96 subtree.
+func WriteMMDB(w io.Writer, table LPMTable, opts *MMDBOptions) error {
+	if opts == nil {
+		opts = &MMDBOptions{}
+	}
+
+	// an excluded prefix takes the entry a lookup falls through to, placed
+	// before any entry of the same prefix length
+	var fallbacks, entries []Entry
+	for _, list := range table.Show() {
+		for _, entry := range list {
+			if !entry.excludesPrefix(entry.Prefix) {
+				entries = append(entries, entry)
+			}
+			for _, exceptNet := range entry.Except {
+				fallback := Entry{Prefix: exceptNet, Entry: mmdbNoRoute{}}
+				if e := fallbackEntry(table, exceptNet); e != nil {
+					fallback.Entry = e.Entry
+				}
+				fallbacks = append(fallbacks, fallback)
+			}
+		}
+	}
+	entries = append(fallbacks, entries...)
+	ipVersion := opts.IPVersion
+	if ipVersion == 0 {
+		ipVersion = 6
+		if tableIPBytesLen(table) == net.IPv4len {
+			ipVersion = 4
+		}
+	}
+	ipBytesLen := net.IPv6len
+	if ipVersion == 4 {
+		ipBytesLen = net.IPv4len
+	} else if ipVersion != 6 {
+		return fmt.Errorf("unsupported mmdb ip version %d", ipVersion)
+	}
+
+	if ipBytesLen == net.IPv6len {
+		// ipv4 networks live in the ::/96 subtree of an ipv6 database
+		for i, entry := range entries {
+			if maskSize, bits := entry.Prefix.Mask.Size(); bits == 8*net.IPv4len {
+				ip := make(net.IP, net.IPv6len)
+				copy(ip[12:], entry.Prefix.IP.To4())
+				entries[i].Prefix = &net.IPNet{IP: ip, Mask: net.CIDRMask(96+maskSize, 8*net.IPv6len)}
+			}
+		}
+	}
+
+	// shorter prefixes first, so longer ones split the leaves they fall in
+	sort.SliceStable(entries, func(i, j int) bool {
+		si, _ := entries[i].Prefix.Mask.Size()
+		sj, _ := entries[j].Prefix.Mask.Size()
+		return si < sj
+	})
+
+	encoder := &mmdbEncoder{dedup: make(map[string]int)}
+	root := &mmdbNode{data: -1}
+	for _, entry := range entries {
+		ip := entry.Prefix.IP
+		if ipBytesLen == net.IPv4len {
+			ip = ip.To4()
+		}
+		if len(ip) != ipBytesLen {
+			return fmt.Errorf("prefix %s does not match mmdb ip version %d", entry.Prefix, ipVersion)
+		}
+		offset := -1
+		if _, noRoute := entry.Entry.(mmdbNoRoute); !noRoute {
+			var err error
+			if offset, err = encoder.record(entry.Entry); err != nil {
+				return fmt.Errorf("prefix %s: %w", entry.Prefix, err)
+			}
+		}
+		maskSize, _ := entry.Prefix.Mask.Size()
+		node := root
+		for depth := 0; depth < maskSize; depth++ {
+			if node.children[0] == nil && node.children[1] == nil {
+				// split a leaf so that its data covers both halves
+				node.children[0] = &mmdbNode{data: node.data}
+				node.children[1] = &mmdbNode{data: node.data}
+				node.data = -1
+			}
+			bit := ip[depth/8] >> (7 - depth%8) & 1
+			if node.children[bit] == nil {
+				node.children[bit] = &mmdbNode{data: -1}
+			}
+			node = node.children[bit]
+		}
+		node.data = offset
+	}
+	if root.children[0] == nil && root.children[1] == nil {
+		root.children[0] = &mmdbNode{data: root.data}
+		root.children[1] = &mmdbNode{data: root.data}
+	}
+
+	// number internal nodes in breadth first order
+	var nodes []*mmdbNode
+	queue := []*mmdbNode{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if node.children[0] == nil && node.children[1] == nil {
+			continue
+		}
+		node.index = uint32(len(nodes))
+		nodes = append(nodes, node)
+		for _, child := range node.children {
+			if child != nil {
+				queue = append(queue, child)
+			}
+		}
+	}
+	nodeCount := uint64(len(nodes))
+	recordValue := func(child *mmdbNode) uint64 {
+		switch {
+		case child == nil:
+			return nodeCount
+		case child.children[0] != nil || child.children[1] != nil:
+			return uint64(child.index)
+		case child.data < 0:
+			return nodeCount
+		}
+		return nodeCount + mmdbDataSeparatorLen + uint64(child.data)
+	}
+
+	recordSize := opts.RecordSize
+	maxRecord := nodeCount + mmdbDataSeparatorLen + uint64(len(encoder.buf))
+	if recordSize == 0 {
+		switch {
+		case maxRecord < 1<<24:
+			recordSize = 24
+		case maxRecord < 1<<28:
+			recordSize = 28
+		default:
+			recordSize = 32
+		}
+	}
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return fmt.Errorf("unsupported mmdb record size %d", recordSize)
+	}
+	if maxRecord >= 1<<recordSize {
+		return fmt.Errorf("mmdb record size %d too small", recordSize)
+	}
+
+	nodeBytes := recordSize / 4
+	out := make([]byte, 0, len(nodes)*nodeBytes+mmdbDataSeparatorLen+len(encoder.buf))
+	for _, node := range nodes {
+		left, right := recordValue(node.children[0]), recordValue(node.children[1])
+		switch recordSize {
+		case 24:
+			out = append(out, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			out = append(out, byte(left>>16), byte(left>>8), byte(left),
+				byte(left>>20&0xf0|right>>24&0x0f), byte(right>>16), byte(right>>8), byte(right))
+		default:
+			out = binary.BigEndian.AppendUint32(out, uint32(left))
+			out = binary.BigEndian.AppendUint32(out, uint32(right))
+		}
+	}
+	out = append(out, make([]byte, mmdbDataSeparatorLen)...)
+	out = append(out, encoder.buf...)
+	out = append(out, mmdbMetadataMarker...)
+
+	buildEpoch := opts.BuildEpoch
+	if buildEpoch == 0 {
+		buildEpoch = uint64(time.Now().Unix())
+	}
+	languages := make([]interface{}, len(opts.Languages))
+	for i, language := range opts.Languages {
+		languages[i] = language
+	}
+	description := make(map[string]interface{}, len(opts.Description))
+	for k, v := range opts.Description {
+		description[k] = v
+	}
+	meta := &mmdbEncoder{}
+	err := meta.encode(map[string]interface{}{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(recordSize),
+		"ip_version":                  uint16(ipVersion),
+		"database_type":               opts.DatabaseType,
+		"languages":                   languages,
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 buildEpoch,
+		"description":                 description,
+	})
+	if err != nil {
+		return err
+	}
+	out = append(out, meta.buf...)
+
+	_, err = w.Write(out)
+	return err
+}
+
+type mmdbEncoder struct {
+	buf   []byte
+	dedup map[string]int // data offset by encoded record
+}
+
+// record Encode a record into the data section once and return its offset
+func (me *mmdbEncoder) record(value interface{}) (int, error) {
+	start := len(me.buf)
+	if err := me.encode(value); err != nil {
+		me.buf = me.buf[:start]
+		return 0, err
+	}
+	key := string(me.buf[start:])
+	if offset, ok := me.dedup[key]; ok {
+		me.buf = me.buf[:start]
+		return offset, nil
+	}
+	me.dedup[key] = start
+	return start, nil
+}
+
+func (me *mmdbEncoder) ctrl(typ int, size int) {
+	var ctrl byte
+	if typ <= 7 {
+		ctrl = byte(typ << 5)
+	}
+	var extra []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		extra = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrl |= 30
+		size -= 285
+		extra = []byte{byte(size >> 8), byte(size)}
+	default:
+		ctrl |= 31
+		size -= 65821
+		extra = []byte{byte(size >> 16), byte(size >> 8), byte(size)}
+	}
+	me.buf = append(me.buf, ctrl)
+	if typ > 7 {
+		me.buf = append(me.buf, byte(typ-7))
+	}
+	me.buf = append(me.buf, extra...)
+}
+
+func (me *mmdbEncoder) uint(typ int, n uint64) {
+	size := 0
+	for v := n; v != 0; v >>= 8 {
+		size++
+	}
+	me.ctrl(typ, size)
+	for i := size - 1; i >= 0; i-- {
+		me.buf = append(me.buf, byte(n>>(8*i)))
+	}
+}
+
+func (me *mmdbEncoder) int(n int64) error {
+	switch {
+	case n >= 0 && n <= math.MaxInt32:
+		me.uint(mmdbInt32, uint64(n))
+	case n >= 0:
+		me.uint(mmdbUint64, uint64(n))
+	case n >= math.MinInt32:
+		me.ctrl(mmdbInt32, 4)
+		me.buf = binary.BigEndian.AppendUint32(me.buf, uint32(int32(n)))
+	default:
+		return fmt.Errorf("integer %d does not fit in mmdb int32", n)
+	}
+	return nil
+}
+
+func (me *mmdbEncoder) encode(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		me.ctrl(mmdbString, len(v))
+		me.buf = append(me.buf, v...)
+	case []byte:
+		me.ctrl(mmdbBytes, len(v))
+		me.buf = append(me.buf, v...)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		me.ctrl(mmdbBool, size)
+	case float64:
+		me.ctrl(mmdbDouble, 8)
+		me.buf = binary.BigEndian.AppendUint64(me.buf, math.Float64bits(v))
+	case float32:
+		me.ctrl(mmdbFloat, 4)
+		me.buf = binary.BigEndian.AppendUint32(me.buf, math.Float32bits(v))
+	case uint16:
+		me.uint(mmdbUint16, uint64(v))
+	case uint32:
+		me.uint(mmdbUint32, uint64(v))
+	case uint8:
+		me.uint(mmdbUint16, uint64(v))
+	case uint:
+		me.uint(mmdbUint64, uint64(v))
+	case uint64:
+		me.uint(mmdbUint64, v)
+	case int:
+		return me.int(int64(v))
+	case int8:
+		return me.int(int64(v))
+	case int16:
+		return me.int(int64(v))
+	case int32:
+		return me.int(int64(v))
+	case int64:
+		return me.int(v)
+	case *big.Int:
+		if v.Sign() < 0 || v.BitLen() > 128 {
+			return fmt.Errorf("integer %s does not fit in mmdb uint128", v)
+		}
+		b := v.Bytes()
+		me.ctrl(mmdbUint128, len(b))
+		me.buf = append(me.buf, b...)
+	case nil:
+		return errors.New("nil value is not supported by mmdb")
+	default:
+		return me.encodeReflect(reflect.ValueOf(value))
+	}
+	return nil
+}
+
+func (me *mmdbEncoder) encodeReflect(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("map key type %s is not supported by mmdb", v.Type().Key())
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		me.ctrl(mmdbMap, len(keys))
+		for _, key := range keys {
+			if err := me.encode(key.String()); err != nil {
+				return err
+			}
+			if err := me.encode(v.MapIndex(key).Interface()); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		me.ctrl(mmdbArray, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := me.encode(v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("type %s is not supported by mmdb", v.Type())
+	}
+	return nil
+}
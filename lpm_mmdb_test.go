@@ -0,0 +1,263 @@
+package golpm
+
+import (
+	"bytes"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMMDB_RoundTrip(t *testing.T) {
+	Convey("Write and load an ipv4 table", t, func() {
+		table := NewRadixLPMTable(false)
+		table.Add("10.0.0.0/8", map[string]interface{}{
+			"asn":     uint64(64512),
+			"country": map[string]interface{}{"iso_code": "US", "names": map[string]interface{}{"en": "United States"}},
+		})
+		table.Add("10.1.0.0/16", map[string]interface{}{
+			"asn":   uint64(64513),
+			"tags":  []interface{}{"anycast", true, 1.5, float32(2.5)},
+			"delta": -7,
+			"big":   new(big.Int).Lsh(big.NewInt(1), 100),
+			"raw":   []byte{1, 2, 3},
+			"long":  strings.Repeat("x", 70000),
+		})
+		table.Add("10.1.2.128/25", "leaf")
+		table.Add("192.168.0.0/16", uint64(1))
+
+		for _, recordSize := range []int{0, 24, 28, 32} {
+			var buf bytes.Buffer
+			err := WriteMMDB(&buf, table, &MMDBOptions{
+				DatabaseType: "Test-ASN",
+				Description:  map[string]string{"en": "test database"},
+				Languages:    []string{"en"},
+				RecordSize:   recordSize,
+				BuildEpoch:   1700000000,
+			})
+			So(err, ShouldBeNil)
+
+			loaded := NewRadixLPMTable(false)
+			meta, err := LoadMMDB(buf.Bytes(), loaded)
+			So(err, ShouldBeNil)
+			So(meta.IPVersion, ShouldEqual, 4)
+			So(meta.DatabaseType, ShouldEqual, "Test-ASN")
+			So(meta.Description["en"], ShouldEqual, "test database")
+			So(meta.Languages, ShouldResemble, []string{"en"})
+			So(meta.BuildEpoch, ShouldEqual, 1700000000)
+			So(meta.BinaryFormatMajorVersion, ShouldEqual, 2)
+			if recordSize != 0 {
+				So(meta.RecordSize, ShouldEqual, recordSize)
+			}
+
+			for _, ip := range []string{"10.0.0.1", "10.1.0.1", "10.1.2.127", "10.1.2.128", "10.1.2.255",
+				"10.255.255.255", "192.168.3.4", "11.0.0.1", "0.0.0.0"} {
+				want, got := table.Lookup(ip), loaded.Lookup(ip)
+				if want == nil {
+					So(got, ShouldBeNil)
+					continue
+				}
+				So(got, ShouldNotBeNil)
+				So(got.Prefix.Contains(net.ParseIP(ip)), ShouldBeTrue)
+				if m, ok := want.Entry.(map[string]interface{}); ok && m["big"] != nil {
+					gm := got.Entry.(map[string]interface{})
+					So(gm["big"].(*big.Int).Cmp(m["big"].(*big.Int)), ShouldEqual, 0)
+					So(gm["asn"], ShouldEqual, uint64(64513))
+					So(gm["delta"], ShouldEqual, -7)
+					So(gm["raw"], ShouldResemble, []byte{1, 2, 3})
+					So(gm["tags"], ShouldResemble, []interface{}{"anycast", true, 1.5, float32(2.5)})
+					So(len(gm["long"].(string)), ShouldEqual, 70000)
+					continue
+				}
+				So(got.Entry, ShouldResemble, want.Entry)
+			}
+		}
+	})
+
+	Convey("Write and load an ipv6 table", t, func() {
+		table := NewRadixLPMTable(true)
+		table.Add("::/0", "default")
+		table.Add("2001:db8::/32", "doc")
+		table.Add("2001:db8:1::/48", map[string]interface{}{"site": "a"})
+		table.Add("::c000:200/120", "v4 subtree")
+
+		var buf bytes.Buffer
+		So(WriteMMDB(&buf, table, nil), ShouldBeNil)
+
+		loaded := NewRadixLPMTable(true)
+		meta, err := LoadMMDB(buf.Bytes(), loaded)
+		So(err, ShouldBeNil)
+		So(meta.IPVersion, ShouldEqual, 6)
+		So(loaded.Lookup("2001:db8::1").Entry, ShouldEqual, "doc")
+		So(loaded.Lookup("2001:db8:1::1").Entry, ShouldResemble, map[string]interface{}{"site": "a"})
+		So(loaded.Lookup("2001:db9::1").Entry, ShouldEqual, "default")
+
+		// the ipv4 subtree of an ipv6 database
+		v4 := NewRadixLPMTable(false)
+		_, err = LoadMMDB(buf.Bytes(), v4)
+		So(err, ShouldBeNil)
+		So(v4.Lookup("192.0.2.1").Entry, ShouldEqual, "v4 subtree")
+		So(v4.Lookup("192.0.3.1").Entry, ShouldEqual, "default")
+	})
+
+	Convey("Write and load a dual table", t, func() {
+		table := NewDualLPMTable(ArchRadix)
+		table.Add("10.0.0.0/8", "a")
+		table.Add("10.1.0.0/16", "b")
+		table.Add("2001:db8::/32", "doc")
+
+		var buf bytes.Buffer
+		So(WriteMMDB(&buf, table, nil), ShouldBeNil)
+
+		loaded := NewDualLPMTable(ArchRadix)
+		meta, err := LoadMMDB(buf.Bytes(), loaded)
+		So(err, ShouldBeNil)
+		So(meta.IPVersion, ShouldEqual, 6)
+		So(loaded.Lookup("10.1.1.1").Prefix.String(), ShouldEqual, "10.1.0.0/16")
+		So(loaded.Lookup("10.2.1.1").Entry, ShouldEqual, "a")
+		So(loaded.Lookup("11.0.0.1"), ShouldBeNil)
+		So(loaded.Lookup("2001:db8::1").Entry, ShouldEqual, "doc")
+		So(loaded.V6.Show(), ShouldResemble, table.V6.Show())
+
+		// a network covering ::/96 covers the ipv4 table too
+		table = NewDualLPMTable(ArchRadix)
+		table.Add("::/8", "low")
+		buf.Reset()
+		So(WriteMMDB(&buf, table, nil), ShouldBeNil)
+		loaded = NewDualLPMTable(ArchRadix)
+		_, err = LoadMMDB(buf.Bytes(), loaded)
+		So(err, ShouldBeNil)
+		So(loaded.Lookup("192.0.2.1").Entry, ShouldEqual, "low")
+		So(loaded.Lookup("::1").Entry, ShouldEqual, "low")
+
+		// an ipv4 database only fills the ipv4 table
+		v4 := NewRadixLPMTable(false)
+		v4.Add("10.0.0.0/8", "a")
+		buf.Reset()
+		So(WriteMMDB(&buf, v4, nil), ShouldBeNil)
+		loaded = NewDualLPMTable(ArchRadix)
+		_, err = LoadMMDB(buf.Bytes(), loaded)
+		So(err, ShouldBeNil)
+		So(loaded.Lookup("10.0.0.1").Entry, ShouldEqual, "a")
+		So(loaded.V6.Show(), ShouldBeEmpty)
+	})
+
+	Convey("Write unsupported entries", t, func() {
+		table := NewRadixLPMTable(false)
+		table.Add("10.0.0.0/8", struct{}{})
+		So(WriteMMDB(&bytes.Buffer{}, table, nil), ShouldBeError)
+
+		table = NewRadixLPMTable(false)
+		table.Add("10.0.0.0/8", map[int]string{1: "a"})
+		So(WriteMMDB(&bytes.Buffer{}, table, nil), ShouldBeError)
+	})
+
+	Convey("Load an ipv4 database into an ipv6 table", t, func() {
+		table := NewRadixLPMTable(false)
+		table.Add("10.0.0.0/8", "a")
+		var buf bytes.Buffer
+		So(WriteMMDB(&buf, table, nil), ShouldBeNil)
+		_, err := LoadMMDB(buf.Bytes(), NewRadixLPMTable(true))
+		So(err, ShouldBeError)
+	})
+
+	Convey("Load corrupt data", t, func() {
+		_, err := LoadMMDB([]byte("not a database"), NewRadixLPMTable(false))
+		So(err, ShouldBeError)
+	})
+}
+
+func TestMMDB_DecodePointer(t *testing.T) {
+	Convey("Decode pointers to shared data", t, func() {
+		encoder := &mmdbEncoder{}
+		encoder.encode("shared")
+		start := len(encoder.buf)
+		// map with one key whose value is a pointer to offset 0
+		encoder.ctrl(mmdbMap, 1)
+		encoder.encode("key")
+		encoder.buf = append(encoder.buf, mmdbPointer<<5, 0)
+
+		decoder := mmdbDecoder{data: encoder.buf}
+		value, next, err := decoder.decode(start)
+		So(err, ShouldBeNil)
+		So(next, ShouldEqual, len(encoder.buf))
+		So(value, ShouldResemble, map[string]interface{}{"key": "shared"})
+	})
+
+	Convey("Decode every size class of strings", t, func() {
+		for _, size := range []int{0, 28, 29, 284, 285, 65820, 65821, 70000} {
+			encoder := &mmdbEncoder{}
+			encoder.encode(strings.Repeat("a", size))
+			decoder := mmdbDecoder{data: encoder.buf}
+			value, _, err := decoder.decode(0)
+			So(err, ShouldBeNil)
+			So(len(value.(string)), ShouldEqual, size)
+		}
+	})
+
+	Convey("Reject pointers to pointers and deep nesting", t, func() {
+		data := []byte{mmdbPointer << 5, 2, mmdbPointer << 5, 0}
+		decoder := mmdbDecoder{data: data}
+		_, _, err := decoder.decode(0)
+		So(err, ShouldBeError)
+
+		encoder := &mmdbEncoder{}
+		for i := 0; i <= mmdbMaxDepth+1; i++ {
+			encoder.ctrl(mmdbArray, 1)
+		}
+		encoder.encode("leaf")
+		decoder = mmdbDecoder{data: encoder.buf}
+		_, _, err = decoder.decode(0)
+		So(err, ShouldBeError)
+	})
+
+	Convey("Decode truncated data", t, func() {
+		for _, data := range [][]byte{{mmdbString<<5 | 5, 'a'}, {mmdbDouble << 5}, {0}} {
+			decoder := mmdbDecoder{data: data}
+			_, _, err := decoder.decode(0)
+			So(err, ShouldBeError)
+		}
+	})
+}
+
+func testMMDB(t testing.TB) []byte {
+	table := NewRadixLPMTable(true)
+	table.Add("::/0", "default")
+	table.Add("2001:db8::/32", map[string]interface{}{"asn": uint64(64512), "tags": []interface{}{"a", true}})
+	table.Add("::a00:0/104", "v4")
+	var buf bytes.Buffer
+	if err := WriteMMDB(&buf, table, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMMDB_Corrupt(t *testing.T) {
+	Convey("Load truncated and altered databases without panicking", t, func() {
+		data := testMMDB(t)
+		metaStart := bytes.LastIndex(data, mmdbMetadataMarker)
+		for n := 0; n < len(data); n++ {
+			truncated := append([]byte(nil), data[n:]...)
+			So(func() { LoadMMDB(truncated, NewRadixLPMTable(true)) }, ShouldNotPanic)
+			// cut the search tree and the data section, keeping the metadata
+			cut := append(append([]byte(nil), data[:n%metaStart]...), data[metaStart:]...)
+			So(func() { LoadMMDB(cut, NewRadixLPMTable(true)) }, ShouldNotPanic)
+			altered := append([]byte(nil), data...)
+			altered[n] ^= 0xff
+			So(func() { LoadMMDB(altered, NewRadixLPMTable(true)) }, ShouldNotPanic)
+		}
+
+		// the metadata alone, with a search tree beyond it
+		_, err := LoadMMDB(data[metaStart:], NewRadixLPMTable(true))
+		So(err, ShouldEqual, errMMDBCorrupt)
+	})
+}
+
+func FuzzLoadMMDB(f *testing.F) {
+	f.Add(testMMDB(f))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		LoadMMDB(data, NewRadixLPMTable(true))
+	})
+}
@@ -0,0 +1,559 @@
+package golpm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"time"
+)
+
+// MRT record types and BGP4MP subtypes, see RFC 6396 and RFC 8050
+const (
+	mrtTypeBGP4MP   = 16
+	mrtTypeBGP4MPET = 17
+
+	bgp4mpMessage                = 1
+	bgp4mpMessageAS4             = 4
+	bgp4mpMessageLocal           = 6
+	bgp4mpMessageAS4Local        = 7
+	bgp4mpMessageAddPath         = 8
+	bgp4mpMessageAS4AddPath      = 9
+	bgp4mpMessageLocalAddPath    = 10
+	bgp4mpMessageLocalAS4AddPath = 11
+
+	mrtHeaderLen = 12
+	bgpHeaderLen = 19
+	bgpUpdate    = 2
+
+	// maxMRTRecordLen The longest BGP4MP_ET record: the microseconds, the
+	// BGP4MP header with 4-byte ASNs and ipv6 addresses, and a BGP message
+	// of the largest extended length
+	maxMRTRecordLen = 4 + 44 + 65535
+
+	bgpAttrOrigin      = 1
+	bgpAttrASPath      = 2
+	bgpAttrNextHop     = 3
+	bgpAttrMED         = 4
+	bgpAttrLocalPref   = 5
+	bgpAttrCommunities = 8
+	bgpAttrMPReach     = 14
+	bgpAttrMPUnreach   = 15
+	bgpAttrAS4Path     = 17
+
+	bgpAFIIPv4     = 1
+	bgpAFIIPv6     = 2
+	bgpSAFIUnicast = 1
+)
+
+var errMRTTruncated = errors.New("truncated mrt record")
+
+// BGPAttrs Path attributes of a BGP UPDATE
+type BGPAttrs struct {
+	Origin      uint8
+	ASPath      []uint32
+	NextHop     net.IP
+	MED         uint32
+	LocalPref   uint32
+	Communities []uint32
+}
+
+// BGPUpdate A BGP UPDATE decoded from a BGP4MP or BGP4MP_ET record
+type BGPUpdate struct {
+	Time      time.Time
+	PeerAS    uint32
+	LocalAS   uint32
+	PeerIP    net.IP
+	LocalIP   net.IP
+	Announced []*net.IPNet
+	Withdrawn []*net.IPNet
+	Attrs     *BGPAttrs
+}
+
+// BGPRoute The default entry stored for an announced prefix during a replay
+type BGPRoute struct {
+	Time   time.Time
+	PeerAS uint32
+	PeerIP net.IP
+	Attrs  *BGPAttrs
+}
+
+// MRTReader Decode BGP UPDATE messages from a stream of MRT records.
+// Records other than BGP4MP/BGP4MP_ET UPDATE messages are skipped.
+type MRTReader struct {
+	r      io.Reader
+	header [mrtHeaderLen]byte
+	buf    []byte
+}
+
+// NewMRTReader Create a MRT reader on top of r
+func NewMRTReader(r io.Reader) *MRTReader {
+	return &MRTReader{r: r}
+}
+
+// Next Return the next BGP UPDATE of the stream, or io.EOF at its end
+func (mr *MRTReader) Next() (*BGPUpdate, error) {
+	for {
+		if _, err := io.ReadFull(mr.r, mr.header[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, errMRTTruncated
+			}
+			return nil, err
+		}
+		ts := binary.BigEndian.Uint32(mr.header[0:4])
+		typ := binary.BigEndian.Uint16(mr.header[4:6])
+		subtype := binary.BigEndian.Uint16(mr.header[6:8])
+		length := int64(binary.BigEndian.Uint32(mr.header[8:12]))
+
+		if typ != mrtTypeBGP4MP && typ != mrtTypeBGP4MPET {
+			// skipped records are not buffered, whatever their length
+			if n, err := io.CopyN(io.Discard, mr.r, length); n < length {
+				if err == io.EOF {
+					err = errMRTTruncated
+				}
+				return nil, err
+			}
+			continue
+		}
+		if length > maxMRTRecordLen {
+			return nil, fmt.Errorf("mrt record of %d bytes too long", length)
+		}
+		if int64(cap(mr.buf)) < length {
+			mr.buf = make([]byte, length)
+		}
+		body := mr.buf[:length]
+		if _, err := io.ReadFull(mr.r, body); err != nil {
+			return nil, errMRTTruncated
+		}
+
+		at := time.Unix(int64(ts), 0).UTC()
+		if typ == mrtTypeBGP4MPET {
+			if len(body) < 4 {
+				return nil, errMRTTruncated
+			}
+			at = at.Add(time.Duration(binary.BigEndian.Uint32(body[0:4])) * time.Microsecond)
+			body = body[4:]
+		}
+		update, err := decodeBGP4MP(subtype, body)
+		if err != nil {
+			return nil, err
+		}
+		if update == nil {
+			continue
+		}
+		update.Time = at
+		return update, nil
+	}
+}
+
+func decodeBGP4MP(subtype uint16, body []byte) (*BGPUpdate, error) {
+	asLen := 2
+	addPath := false
+	switch subtype {
+	case bgp4mpMessage, bgp4mpMessageLocal:
+	case bgp4mpMessageAS4, bgp4mpMessageAS4Local:
+		asLen = 4
+	case bgp4mpMessageAddPath, bgp4mpMessageLocalAddPath:
+		addPath = true
+	case bgp4mpMessageAS4AddPath, bgp4mpMessageLocalAS4AddPath:
+		asLen = 4
+		addPath = true
+	default:
+		// state changes and unknown subtypes carry no routes
+		return nil, nil
+	}
+
+	if len(body) < 2*asLen+4 {
+		return nil, errMRTTruncated
+	}
+	update := &BGPUpdate{}
+	if asLen == 4 {
+		update.PeerAS = binary.BigEndian.Uint32(body[0:4])
+		update.LocalAS = binary.BigEndian.Uint32(body[4:8])
+	} else {
+		update.PeerAS = uint32(binary.BigEndian.Uint16(body[0:2]))
+		update.LocalAS = uint32(binary.BigEndian.Uint16(body[2:4]))
+	}
+	body = body[2*asLen+2:] // skip interface index
+	afi := binary.BigEndian.Uint16(body[0:2])
+	body = body[2:]
+
+	ipLen := net.IPv4len
+	if afi == bgpAFIIPv6 {
+		ipLen = net.IPv6len
+	} else if afi != bgpAFIIPv4 {
+		return nil, errors.New("unknown address family in bgp4mp record")
+	}
+	if len(body) < 2*ipLen+bgpHeaderLen {
+		return nil, errMRTTruncated
+	}
+	update.PeerIP = append(net.IP(nil), body[:ipLen]...)
+	update.LocalIP = append(net.IP(nil), body[ipLen:2*ipLen]...)
+	body = body[2*ipLen:]
+
+	msgLen := int(binary.BigEndian.Uint16(body[16:18]))
+	if body[18] != bgpUpdate {
+		return nil, nil
+	}
+	if msgLen < bgpHeaderLen || msgLen > len(body) {
+		return nil, errMRTTruncated
+	}
+	if err := decodeBGPUpdate(update, body[bgpHeaderLen:msgLen], asLen, addPath); err != nil {
+		return nil, err
+	}
+	return update, nil
+}
+
+func decodeBGPUpdate(update *BGPUpdate, msg []byte, asLen int, addPath bool) error {
+	var err error
+
+	if len(msg) < 2 {
+		return errMRTTruncated
+	}
+	withdrawnLen := int(binary.BigEndian.Uint16(msg[0:2]))
+	msg = msg[2:]
+	if len(msg) < withdrawnLen+2 {
+		return errMRTTruncated
+	}
+	update.Withdrawn, err = decodeNLRI(update.Withdrawn, msg[:withdrawnLen], net.IPv4len, addPath)
+	if err != nil {
+		return err
+	}
+	msg = msg[withdrawnLen:]
+
+	attrsLen := int(binary.BigEndian.Uint16(msg[0:2]))
+	msg = msg[2:]
+	if len(msg) < attrsLen {
+		return errMRTTruncated
+	}
+	if attrsLen > 0 {
+		update.Attrs = &BGPAttrs{}
+		if err = decodeBGPAttrs(update, msg[:attrsLen], asLen, addPath); err != nil {
+			return err
+		}
+	}
+	update.Announced, err = decodeNLRI(update.Announced, msg[attrsLen:], net.IPv4len, addPath)
+	return err
+}
+
+func decodeBGPAttrs(update *BGPUpdate, attrs []byte, asLen int, addPath bool) error {
+	var as4Path []uint32
+	var err error
+
+	for len(attrs) > 0 {
+		if len(attrs) < 3 {
+			return errMRTTruncated
+		}
+		flags, typ := attrs[0], attrs[1]
+		var length int
+		if flags&0x10 != 0 {
+			if len(attrs) < 4 {
+				return errMRTTruncated
+			}
+			length = int(binary.BigEndian.Uint16(attrs[2:4]))
+			attrs = attrs[4:]
+		} else {
+			length = int(attrs[2])
+			attrs = attrs[3:]
+		}
+		if len(attrs) < length {
+			return errMRTTruncated
+		}
+		value := attrs[:length]
+		attrs = attrs[length:]
+
+		switch typ {
+		case bgpAttrOrigin:
+			if length > 0 {
+				update.Attrs.Origin = value[0]
+			}
+		case bgpAttrASPath:
+			if update.Attrs.ASPath, err = decodeASPath(value, asLen); err != nil {
+				return err
+			}
+		case bgpAttrAS4Path:
+			if as4Path, err = decodeASPath(value, 4); err != nil {
+				return err
+			}
+		case bgpAttrNextHop:
+			if update.Attrs.NextHop == nil {
+				update.Attrs.NextHop = append(net.IP(nil), value...)
+			}
+		case bgpAttrMED:
+			if length == 4 {
+				update.Attrs.MED = binary.BigEndian.Uint32(value)
+			}
+		case bgpAttrLocalPref:
+			if length == 4 {
+				update.Attrs.LocalPref = binary.BigEndian.Uint32(value)
+			}
+		case bgpAttrCommunities:
+			for i := 0; i+4 <= length; i += 4 {
+				update.Attrs.Communities = append(update.Attrs.Communities, binary.BigEndian.Uint32(value[i:]))
+			}
+		case bgpAttrMPReach:
+			if err = decodeMPReach(update, value, addPath); err != nil {
+				return err
+			}
+		case bgpAttrMPUnreach:
+			if err = decodeMPUnreach(update, value, addPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	// merge AS4_PATH into a 2-byte AS_PATH as described in RFC 6793
+	if asLen == 2 && len(as4Path) > 0 && len(as4Path) <= len(update.Attrs.ASPath) {
+		path := update.Attrs.ASPath[:len(update.Attrs.ASPath)-len(as4Path)]
+		update.Attrs.ASPath = append(path, as4Path...)
+	}
+	return nil
+}
+
+func decodeASPath(value []byte, asLen int) ([]uint32, error) {
+	var path []uint32
+	for len(value) > 0 {
+		if len(value) < 2 {
+			return nil, errMRTTruncated
+		}
+		count := int(value[1])
+		value = value[2:]
+		if len(value) < count*asLen {
+			return nil, errMRTTruncated
+		}
+		for i := 0; i < count; i++ {
+			if asLen == 4 {
+				path = append(path, binary.BigEndian.Uint32(value[i*4:]))
+			} else {
+				path = append(path, uint32(binary.BigEndian.Uint16(value[i*2:])))
+			}
+		}
+		value = value[count*asLen:]
+	}
+	return path, nil
+}
+
+func afiIPLen(afi uint16) int {
+	switch afi {
+	case bgpAFIIPv4:
+		return net.IPv4len
+	case bgpAFIIPv6:
+		return net.IPv6len
+	}
+	return 0
+}
+
+func decodeMPReach(update *BGPUpdate, value []byte, addPath bool) error {
+	if len(value) < 5 {
+		return errMRTTruncated
+	}
+	ipLen := afiIPLen(binary.BigEndian.Uint16(value[0:2]))
+	safi := value[2]
+	nhLen := int(value[3])
+	value = value[4:]
+	if len(value) < nhLen+1 {
+		return errMRTTruncated
+	}
+	if ipLen == 0 || safi != bgpSAFIUnicast {
+		return nil
+	}
+	if nhLen >= ipLen {
+		// the first next hop is the global one for ipv6
+		update.Attrs.NextHop = append(net.IP(nil), value[:ipLen]...)
+	}
+	value = value[nhLen+1:] // skip the reserved byte
+
+	var err error
+	update.Announced, err = decodeNLRI(update.Announced, value, ipLen, addPath)
+	return err
+}
+
+func decodeMPUnreach(update *BGPUpdate, value []byte, addPath bool) error {
+	if len(value) < 3 {
+		return errMRTTruncated
+	}
+	ipLen := afiIPLen(binary.BigEndian.Uint16(value[0:2]))
+	if ipLen == 0 || value[2] != bgpSAFIUnicast {
+		return nil
+	}
+
+	var err error
+	update.Withdrawn, err = decodeNLRI(update.Withdrawn, value[3:], ipLen, addPath)
+	return err
+}
+
+func decodeNLRI(prefixes []*net.IPNet, nlri []byte, ipLen int, addPath bool) ([]*net.IPNet, error) {
+	for len(nlri) > 0 {
+		if addPath {
+			if len(nlri) < 4 {
+				return nil, errMRTTruncated
+			}
+			nlri = nlri[4:]
+		}
+		if len(nlri) < 1 {
+			return nil, errMRTTruncated
+		}
+		maskSize := int(nlri[0])
+		byteCount := (maskSize + 7) / 8
+		if maskSize > ipLen*8 {
+			return nil, errors.New("invalid prefix length in nlri")
+		}
+		if len(nlri) < 1+byteCount {
+			return nil, errMRTTruncated
+		}
+		ip := make(net.IP, ipLen)
+		copy(ip, nlri[1:1+byteCount])
+		mask := net.CIDRMask(maskSize, ipLen*8)
+		prefixes = append(prefixes, &net.IPNet{
+			IP:   ip.Mask(mask),
+			Mask: mask,
+		})
+		nlri = nlri[1+byteCount:]
+	}
+	return prefixes, nil
+}
+
+// MRTReplayer Apply BGP4MP update streams to lpm tables in timestamp order.
+// Announcements are applied through AddIPNet and withdrawals through
+// DeleteIPNet on the table of the address family of their NLRI. IPv6
+// prefixes inside ::ffff:0:0/96 are skipped, lpm tables telling ipv4
+// addresses apart from their ipv4-mapped form.
+type MRTReplayer struct {
+	V4 LPMTable
+	V6 LPMTable
+
+	// Filter decides whether an update is applied, all updates are applied when nil
+	Filter func(update *BGPUpdate) bool
+	// OnUpdate is called after each applied update
+	OnUpdate func(update *BGPUpdate)
+	// Entry builds the entry of an announced prefix, a *BGPRoute is stored when nil
+	Entry func(update *BGPUpdate, prefix *net.IPNet) interface{}
+
+	// Checkpoints are the times at which OnCheckpoint observes the tables,
+	// in any order, observed in time order. A checkpoint sees every update
+	// stamped at or before it.
+	Checkpoints  []time.Time
+	OnCheckpoint func(at time.Time, v4, v6 LPMTable)
+
+	checkpoints    []time.Time // sorted Checkpoints
+	nextCheckpoint int
+}
+
+// Replay Apply the updates of all streams merged by timestamp.
+// Each stream is expected to be in timestamp order itself, as MRT update
+// archives are.
+func (mr *MRTReplayer) Replay(streams ...io.Reader) error {
+	readers := make([]*MRTReader, len(streams))
+	heads := make([]*BGPUpdate, len(streams))
+	for i, stream := range streams {
+		readers[i] = NewMRTReader(stream)
+		if err := mr.advance(readers[i], &heads[i]); err != nil {
+			return err
+		}
+	}
+	mr.checkpoints = append([]time.Time(nil), mr.Checkpoints...)
+	sort.Slice(mr.checkpoints, func(i, j int) bool {
+		return mr.checkpoints[i].Before(mr.checkpoints[j])
+	})
+	mr.nextCheckpoint = 0
+
+	for {
+		next := -1
+		for i, head := range heads {
+			if head != nil && (next < 0 || head.Time.Before(heads[next].Time)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		if err := mr.apply(heads[next]); err != nil {
+			return err
+		}
+		if err := mr.advance(readers[next], &heads[next]); err != nil {
+			return err
+		}
+	}
+	mr.checkpointUntil(time.Time{}, true)
+	return nil
+}
+
+func (mr *MRTReplayer) advance(reader *MRTReader, head **BGPUpdate) error {
+	update, err := reader.Next()
+	if err == io.EOF {
+		*head = nil
+		return nil
+	}
+	*head = update
+	return err
+}
+
+func (mr *MRTReplayer) checkpointUntil(at time.Time, all bool) {
+	for mr.nextCheckpoint < len(mr.checkpoints) {
+		checkpoint := mr.checkpoints[mr.nextCheckpoint]
+		if !all && !checkpoint.Before(at) {
+			return
+		}
+		if mr.OnCheckpoint != nil {
+			mr.OnCheckpoint(checkpoint, mr.V4, mr.V6)
+		}
+		mr.nextCheckpoint++
+	}
+}
+
+// tableFor Return the table of the address family of prefix, which is
+// decoded in the address length of its AFI, nil to skip it
+func (mr *MRTReplayer) tableFor(prefix *net.IPNet) LPMTable {
+	if len(prefix.IP) == net.IPv4len {
+		return mr.V4
+	}
+	if prefix.IP.To4() != nil {
+		// ipv4-mapped, an ipv6 table would take it for ipv4
+		return nil
+	}
+	return mr.V6
+}
+
+func (mr *MRTReplayer) apply(update *BGPUpdate) error {
+	mr.checkpointUntil(update.Time, false)
+	if mr.Filter != nil && !mr.Filter(update) {
+		return nil
+	}
+
+	for _, prefix := range update.Withdrawn {
+		table := mr.tableFor(prefix)
+		if table == nil {
+			continue
+		}
+		if err := table.DeleteIPNet(prefix); err != nil {
+			return err
+		}
+	}
+	for _, prefix := range update.Announced {
+		table := mr.tableFor(prefix)
+		if table == nil {
+			continue
+		}
+		var entry interface{}
+		if mr.Entry != nil {
+			entry = mr.Entry(update, prefix)
+		} else {
+			entry = &BGPRoute{
+				Time:   update.Time,
+				PeerAS: update.PeerAS,
+				PeerIP: update.PeerIP,
+				Attrs:  update.Attrs,
+			}
+		}
+		if err := table.AddIPNet(prefix, entry); err != nil {
+			return err
+		}
+	}
+
+	if mr.OnUpdate != nil {
+		mr.OnUpdate(update)
+	}
+	return nil
+}
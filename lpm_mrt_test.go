@@ -0,0 +1,254 @@
+package golpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func encodeTestNLRI(prefixes ...string) []byte {
+	var nlri []byte
+	for _, prefix := range prefixes {
+		_, cidr, _ := net.ParseCIDR(prefix)
+		maskSize, _ := cidr.Mask.Size()
+		ip := cidr.IP
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		nlri = append(nlri, byte(maskSize))
+		nlri = append(nlri, ip[:(maskSize+7)/8]...)
+	}
+	return nlri
+}
+
+func encodeTestAttr(typ byte, value []byte) []byte {
+	attr := []byte{0x50, typ, 0, 0}
+	binary.BigEndian.PutUint16(attr[2:], uint16(len(value)))
+	return append(attr, value...)
+}
+
+// encodeTestBGP4MP Build a BGP4MP_MESSAGE_AS4 record holding an UPDATE
+func encodeTestBGP4MP(ts uint32, micro int64, peerAS uint32, withdrawn, announced []string, asPath ...uint32) []byte {
+	var v4Withdrawn, v4Announced, v6Withdrawn, v6Announced []string
+	for _, prefix := range withdrawn {
+		if net.ParseIP(prefix[:bytes.IndexByte([]byte(prefix), '/')]).To4() != nil {
+			v4Withdrawn = append(v4Withdrawn, prefix)
+		} else {
+			v6Withdrawn = append(v6Withdrawn, prefix)
+		}
+	}
+	for _, prefix := range announced {
+		if net.ParseIP(prefix[:bytes.IndexByte([]byte(prefix), '/')]).To4() != nil {
+			v4Announced = append(v4Announced, prefix)
+		} else {
+			v6Announced = append(v6Announced, prefix)
+		}
+	}
+
+	var attrs []byte
+	if len(announced) > 0 {
+		attrs = append(attrs, encodeTestAttr(bgpAttrOrigin, []byte{0})...)
+		path := []byte{2, byte(len(asPath))}
+		for _, as := range asPath {
+			path = binary.BigEndian.AppendUint32(path, as)
+		}
+		attrs = append(attrs, encodeTestAttr(bgpAttrASPath, path)...)
+		attrs = append(attrs, encodeTestAttr(bgpAttrNextHop, []byte{192, 0, 2, 1})...)
+	}
+	if len(v6Announced) > 0 {
+		reach := []byte{0, bgpAFIIPv6, bgpSAFIUnicast, net.IPv6len}
+		reach = append(reach, net.ParseIP("2001:db8::1")...)
+		reach = append(reach, 0)
+		reach = append(reach, encodeTestNLRI(v6Announced...)...)
+		attrs = append(attrs, encodeTestAttr(bgpAttrMPReach, reach)...)
+	}
+	if len(v6Withdrawn) > 0 {
+		unreach := []byte{0, bgpAFIIPv6, bgpSAFIUnicast}
+		unreach = append(unreach, encodeTestNLRI(v6Withdrawn...)...)
+		attrs = append(attrs, encodeTestAttr(bgpAttrMPUnreach, unreach)...)
+	}
+
+	var update []byte
+	withdrawnNLRI := encodeTestNLRI(v4Withdrawn...)
+	update = binary.BigEndian.AppendUint16(update, uint16(len(withdrawnNLRI)))
+	update = append(update, withdrawnNLRI...)
+	update = binary.BigEndian.AppendUint16(update, uint16(len(attrs)))
+	update = append(update, attrs...)
+	update = append(update, encodeTestNLRI(v4Announced...)...)
+
+	msg := bytes.Repeat([]byte{0xff}, 16)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(bgpHeaderLen+len(update)))
+	msg = append(msg, bgpUpdate)
+	msg = append(msg, update...)
+
+	var body []byte
+	typ := uint16(mrtTypeBGP4MP)
+	if micro >= 0 {
+		typ = mrtTypeBGP4MPET
+		body = binary.BigEndian.AppendUint32(body, uint32(micro))
+	}
+	body = binary.BigEndian.AppendUint32(body, peerAS)
+	body = binary.BigEndian.AppendUint32(body, 65000)
+	body = binary.BigEndian.AppendUint16(body, 0)
+	body = binary.BigEndian.AppendUint16(body, bgpAFIIPv4)
+	body = append(body, 192, 0, 2, 1, 192, 0, 2, 2)
+	body = append(body, msg...)
+
+	var record []byte
+	record = binary.BigEndian.AppendUint32(record, ts)
+	record = binary.BigEndian.AppendUint16(record, typ)
+	record = binary.BigEndian.AppendUint16(record, bgp4mpMessageAS4)
+	record = binary.BigEndian.AppendUint32(record, uint32(len(body)))
+	return append(record, body...)
+}
+
+func TestMRTReader_Next(t *testing.T) {
+	Convey("Decode an ipv4 and ipv6 update", t, func() {
+		var stream []byte
+		stream = append(stream, encodeTestBGP4MP(100, 250, 64512,
+			[]string{"198.51.100.0/24", "2001:db8:1::/48"},
+			[]string{"192.0.2.0/24", "10.0.0.0/8", "2001:db8::/32"},
+			64512, 64513)...)
+
+		reader := NewMRTReader(bytes.NewReader(stream))
+		update, err := reader.Next()
+		So(err, ShouldBeNil)
+		So(update.Time, ShouldEqual, time.Unix(100, 250000).UTC())
+		So(update.PeerAS, ShouldEqual, 64512)
+		So(update.LocalAS, ShouldEqual, 65000)
+		So(update.PeerIP.String(), ShouldEqual, "192.0.2.1")
+		So(len(update.Announced), ShouldEqual, 3)
+		So(update.Announced[0].String(), ShouldEqual, "2001:db8::/32")
+		So(update.Announced[1].String(), ShouldEqual, "192.0.2.0/24")
+		So(update.Announced[2].String(), ShouldEqual, "10.0.0.0/8")
+		So(len(update.Withdrawn), ShouldEqual, 2)
+		So(update.Withdrawn[0].String(), ShouldEqual, "198.51.100.0/24")
+		So(update.Withdrawn[1].String(), ShouldEqual, "2001:db8:1::/48")
+		So(update.Attrs.ASPath, ShouldResemble, []uint32{64512, 64513})
+		So(update.Attrs.NextHop.String(), ShouldEqual, "2001:db8::1")
+
+		_, err = reader.Next()
+		So(err, ShouldEqual, io.EOF)
+	})
+
+	Convey("Reject records claiming a huge length", t, func() {
+		header := []byte{0, 0, 0, 100, 0, mrtTypeBGP4MP, 0, bgp4mpMessageAS4, 0xff, 0xff, 0xff, 0xff}
+		reader := NewMRTReader(bytes.NewReader(header))
+		_, err := reader.Next()
+		So(err, ShouldBeError)
+		So(err, ShouldNotEqual, errMRTTruncated)
+		allocs := testing.AllocsPerRun(10, func() {
+			NewMRTReader(bytes.NewReader(header)).Next()
+		})
+		So(allocs, ShouldBeLessThan, 10)
+
+		// other record types are skipped without being buffered
+		header[5] = 13
+		reader = NewMRTReader(bytes.NewReader(header))
+		_, err = reader.Next()
+		So(err, ShouldEqual, errMRTTruncated)
+
+		record := encodeTestBGP4MP(100, -1, 64512, nil, []string{"10.0.0.0/8"}, 64512)
+		skipped := append([]byte{0, 0, 0, 99, 0, 13, 0, 1, 0, 0, 0, 3}, 1, 2, 3)
+		reader = NewMRTReader(bytes.NewReader(append(skipped, record...)))
+		update, err := reader.Next()
+		So(err, ShouldBeNil)
+		So(update.Announced[0].String(), ShouldEqual, "10.0.0.0/8")
+	})
+
+	Convey("Decode a truncated record", t, func() {
+		record := encodeTestBGP4MP(100, -1, 64512, nil, []string{"192.0.2.0/24"}, 64512)
+		reader := NewMRTReader(bytes.NewReader(record[:len(record)-3]))
+		_, err := reader.Next()
+		So(err, ShouldBeError)
+	})
+}
+
+func TestMRTReplayer_Replay(t *testing.T) {
+	Convey("Replay updates and checkpoint the tables", t, func() {
+		var stream1, stream2 []byte
+		stream1 = append(stream1, encodeTestBGP4MP(100, -1, 64512, nil, []string{"10.0.0.0/8", "2001:db8::/32"}, 64512)...)
+		stream1 = append(stream1, encodeTestBGP4MP(300, -1, 64512, []string{"10.0.0.0/8"}, nil)...)
+		stream2 = append(stream2, encodeTestBGP4MP(200, -1, 64513, nil, []string{"10.1.0.0/16"}, 64513)...)
+		stream2 = append(stream2, encodeTestBGP4MP(400, -1, 64513, []string{"2001:db8::/32"}, nil)...)
+
+		var updates []uint32
+		var snapshots []map[int][]Entry
+		replayer := &MRTReplayer{
+			V4: NewRadixLPMTable(false),
+			V6: NewRadixLPMTable(true),
+			OnUpdate: func(update *BGPUpdate) {
+				updates = append(updates, uint32(update.Time.Unix()))
+			},
+			Checkpoints: []time.Time{time.Unix(150, 0), time.Unix(300, 0), time.Unix(1000, 0)},
+			OnCheckpoint: func(at time.Time, v4, v6 LPMTable) {
+				snapshots = append(snapshots, v4.Show())
+			},
+		}
+		err := replayer.Replay(bytes.NewReader(stream1), bytes.NewReader(stream2))
+		So(err, ShouldBeNil)
+		So(updates, ShouldResemble, []uint32{100, 200, 300, 400})
+
+		So(len(snapshots), ShouldEqual, 3)
+		So(len(snapshots[0][8]), ShouldEqual, 1)
+		So(len(snapshots[0][16]), ShouldEqual, 0)
+		So(len(snapshots[1][8]), ShouldEqual, 0)
+		So(len(snapshots[1][16]), ShouldEqual, 1)
+
+		entry := replayer.V4.Lookup("10.1.2.3")
+		So(entry.Prefix.String(), ShouldEqual, "10.1.0.0/16")
+		So(entry.Entry.(*BGPRoute).PeerAS, ShouldEqual, 64513)
+		So(replayer.V4.Lookup("10.2.0.1"), ShouldBeNil)
+		So(replayer.V6.Lookup("2001:db8::1"), ShouldBeNil)
+	})
+
+	Convey("Dispatch prefixes on the address family of their nlri", t, func() {
+		replayer := &MRTReplayer{
+			V4: NewRadixLPMTable(false),
+			V6: NewRadixLPMTable(true),
+		}
+		mapped, err := decodeNLRI(nil, []byte{104, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 10}, net.IPv6len, false)
+		So(err, ShouldBeNil)
+		v4, err := decodeNLRI(nil, []byte{16, 10, 1}, net.IPv4len, false)
+		So(err, ShouldBeNil)
+		So(replayer.apply(&BGPUpdate{Announced: append(mapped, v4...)}), ShouldBeNil)
+		So(replayer.V4.Lookup("10.1.0.1").Prefix.String(), ShouldEqual, "10.1.0.0/16")
+		So(replayer.V4.Lookup("10.2.0.1"), ShouldBeNil)
+		So(replayer.V6.Show(), ShouldBeEmpty)
+	})
+
+	Convey("Checkpoint in time order", t, func() {
+		stream := encodeTestBGP4MP(100, -1, 64512, nil, []string{"10.0.0.0/8"}, 64512)
+		var seen []int64
+		replayer := &MRTReplayer{
+			V4:          NewRadixLPMTable(false),
+			Checkpoints: []time.Time{time.Unix(200, 0), time.Unix(50, 0)},
+			OnCheckpoint: func(at time.Time, v4, v6 LPMTable) {
+				seen = append(seen, at.Unix())
+			},
+		}
+		So(replayer.Replay(bytes.NewReader(stream)), ShouldBeNil)
+		So(seen, ShouldResemble, []int64{50, 200})
+		So(replayer.Checkpoints[0].Unix(), ShouldEqual, 200)
+	})
+
+	Convey("Replay with a filter", t, func() {
+		stream := encodeTestBGP4MP(100, -1, 64512, nil, []string{"10.0.0.0/8"}, 64512)
+		stream = append(stream, encodeTestBGP4MP(101, -1, 64513, nil, []string{"10.1.0.0/16"}, 64513)...)
+		replayer := &MRTReplayer{
+			V4: NewRadixLPMTable(false),
+			Filter: func(update *BGPUpdate) bool {
+				return update.PeerAS == 64513
+			},
+		}
+		err := replayer.Replay(bytes.NewReader(stream))
+		So(err, ShouldBeNil)
+		So(replayer.V4.Lookup("10.2.0.1"), ShouldBeNil)
+		So(replayer.V4.Lookup("10.1.0.1"), ShouldNotBeNil)
+	})
+}
@@ -2,36 +2,188 @@ package golpm
 
 import (
 	"errors"
-	"math"
+	"fmt"
 	"net"
+	"net/netip"
+	"time"
 )
 
 type RadixTable struct {
 	root         *radixNode
 	defaultEntry *Entry
 	ipBytesLen   int
+	fallback     LPMTable // lookup table of throw routes
+	watchers     []*tableWatcher
+	expiry       expiryIndex
+	clock        func() time.Time
+	onExpire     func(entry *Entry)
+	sources      *sourceIndex
+	precompute   bool         // maintain the best match arrays of the nodes
+	levels       []radixLevel // nil for 8-bit strides
 }
 
+// radixLevel The bits of the address indexing the children of the nodes at
+// a depth, the children storing the prefixes ending in these bits
+type radixLevel struct {
+	offset int
+	width  int
+}
+
+const (
+	minRadixStride = 4
+	maxRadixStride = 16
+)
+
 type radixNode struct {
 	childCnt int
 	entryCnt int
-	children [256]*radixNode
-	entries  [8]*Entry // routing entries stored by the node
+	width    int          // bits of the child indexes, 0 at the last level
+	sparse   []sparseWord // bitmap of the children when stored sparse
+	children []*radixNode // packed when sparse, else a slot per index
+	entries  []*Entry     // routing entries stored by the node, stride of them
+	// best match of each child index among the entries of the children,
+	// only allocated by tables precomputing best matches
+	best []*Entry
+}
+
+// newRadixTable Create an empty table of ipBytesLen addresses, 0 for both
+// families, split in levels
+func newRadixTable(ipBytesLen int, levels []radixLevel) *RadixTable {
+	rt := &RadixTable{
+		ipBytesLen: ipBytesLen,
+		levels:     levels,
+	}
+	rt.root = rt.newNode(0)
+	return rt
+}
+
+// emptyLike Create an empty table with the family and the layout of rt
+func (rt *RadixTable) emptyLike() *RadixTable {
+	table := newRadixTable(rt.ipBytesLen, rt.levels)
+	table.precompute = rt.precompute
+	return table
+}
+
+// bits Return the address length of the table in bits
+func (rt *RadixTable) bits() int {
+	if rt.ipBytesLen == 0 {
+		return net.IPv6len * 8
+	}
+	return rt.ipBytesLen * 8
 }
 
-func traverse(deep int, node *radixNode, entries map[int][]Entry) {
+// level Return the level of the nodes at depth. Past the last level the
+// offset is the address length.
+func (rt *RadixTable) level(depth int) radixLevel {
+	if rt.levels == nil {
+		return radixLevel{offset: depth * 8, width: 8}
+	}
+	if depth < len(rt.levels) {
+		return rt.levels[depth]
+	}
+	last := rt.levels[len(rt.levels)-1]
+	return radixLevel{offset: last.offset + last.width}
+}
+
+// newNode Create a node at depth, the root being at depth 0
+func (rt *RadixTable) newNode(depth int) *radixNode {
+	node := &radixNode{}
+	if depth > 0 {
+		node.entries = make([]*Entry, rt.level(depth-1).width)
+	}
+	if level := rt.level(depth); level.offset < rt.bits() {
+		node.width = level.width
+	}
+	return node
+}
+
+// prefixLevels Return the number of levels a prefix of maskSize bits
+// spans and the index of its entry in the last node
+func (rt *RadixTable) prefixLevels(maskSize int) (count, entryIdx int) {
+	for {
+		level := rt.level(count)
+		count++
+		if maskSize <= level.offset+level.width {
+			return count, maskSize - level.offset - 1
+		}
+	}
+}
+
+// index Return the child index of ip at the level, missing bytes being 0
+func (l radixLevel) index(ip []byte) int {
+	if l.width == 8 && l.offset%8 == 0 {
+		return int(ip[l.offset/8])
+	}
+	var val uint32
+	end := l.offset + l.width
+	for i := l.offset / 8; i <= (end-1)/8; i++ {
+		val <<= 8
+		if i < len(ip) {
+			val |= uint32(ip[i])
+		}
+	}
+	val >>= uint(7 - (end-1)%8)
+	return int(val & (1<<l.width - 1))
+}
+
+// RadixOption Configure a radix table on construction
+type RadixOption func(rt *RadixTable)
+
+// WithPrecomputedBest Maintain a best match array per node on add and
+// delete, so that a lookup resolves each level with one index instead of
+// scanning every prefix length of the stride. Costs one pointer per child
+// slot of the nodes with entries below them, 2 KiB with 8-bit strides.
+func WithPrecomputedBest() RadixOption {
+	return func(rt *RadixTable) {
+		rt.precompute = true
+	}
+}
+
+// WithStrides Index the nodes with strides of the given bits, level after
+// level from the most significant bits, the last stride repeating until
+// the address is covered and the final one truncated to fit: 16, 8, 8 for
+// ipv4 or 16 for ipv6. Wide strides make lookups shallower and nodes
+// bigger. Strides must be of 4 to 16 bits, the default is 8.
+func WithStrides(strides ...int) RadixOption {
+	if len(strides) == 0 {
+		panic("golpm: no strides")
+	}
+	for _, stride := range strides {
+		if stride < minRadixStride || stride > maxRadixStride {
+			panic(fmt.Sprintf("golpm: stride of %d bits, expect %d to %d", stride, minRadixStride, maxRadixStride))
+		}
+	}
+	return func(rt *RadixTable) {
+		var levels []radixLevel
+		for offset, i := 0, 0; offset < rt.bits(); i++ {
+			width := strides[len(strides)-1]
+			if i < len(strides) {
+				width = strides[i]
+			}
+			if offset+width > rt.bits() {
+				width = rt.bits() - offset
+			}
+			levels = append(levels, radixLevel{offset: offset, width: width})
+			offset += width
+		}
+		rt.levels = levels
+		rt.root = rt.newNode(0)
+	}
+}
+
+func traverse(node *radixNode, entries map[int][]Entry) {
 	if node == nil {
 		return
 	}
-	for maskTail, entry := range node.entries {
+	for _, entry := range node.entries {
 		if entry == nil {
 			continue
 		}
-		maskSize := deep*8 + maskTail + 1
+		maskSize, _ := entry.Prefix.Mask.Size()
 		entries[maskSize] = append(entries[maskSize], *entry)
 	}
 	for _, child := range node.children {
-		traverse(deep+1, child, entries)
+		traverse(child, entries)
 	}
 }
 
@@ -40,7 +192,7 @@ func (rt *RadixTable) Show() map[int][]Entry {
 	var entries map[int][]Entry
 	entries = make(map[int][]Entry)
 	for _, node := range rt.root.children {
-		traverse(0, node, entries)
+		traverse(node, entries)
 	}
 	if rt.defaultEntry != nil {
 		entries[0] = append(entries[0], *rt.defaultEntry)
@@ -48,6 +200,74 @@ func (rt *RadixTable) Show() map[int][]Entry {
 	return entries
 }
 
+func walk(node *radixNode, fn func(entry *Entry) bool) bool {
+	if node == nil {
+		return true
+	}
+	for _, entry := range node.entries {
+		if entry != nil && !fn(entry) {
+			return false
+		}
+	}
+	for _, child := range node.children {
+		if !walk(child, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// Walk Call fn for each entry in prefix order until fn returns false.
+// Prefix order sorts entries by network address, then by mask length.
+func (rt *RadixTable) Walk(fn func(entry *Entry) bool) {
+	if rt.defaultEntry != nil && !fn(rt.defaultEntry) {
+		return
+	}
+	for _, node := range rt.root.children {
+		if !walk(node, fn) {
+			return
+		}
+	}
+}
+
+// walkWithin Call fn for the entry of prefix and of each of its
+// sub-prefixes until fn returns false
+func (rt *RadixTable) walkWithin(prefix *net.IPNet, fn func(entry *Entry) bool) {
+	maskSize, _ := prefix.Mask.Size()
+	if maskSize == 0 {
+		rt.Walk(fn)
+		return
+	}
+
+	levelCount, entryIdx := rt.prefixLevels(maskSize)
+	ipBytes := []byte(prefix.IP)
+	parent := rt.root
+	for i := 0; i < levelCount-1; i++ {
+		if parent = parent.child(rt.level(i).index(ipBytes)); parent == nil {
+			return
+		}
+	}
+	// the children in the span of prefix hold its sub-prefixes ending at
+	// this level, shorter entries only being stored at the first of them
+	first, end := parent.span(rt.level(levelCount-1).index(ipBytes), entryIdx+1)
+	for idx := first; idx < end; idx++ {
+		node := parent.child(idx)
+		if node == nil {
+			continue
+		}
+		for _, entry := range node.entries[entryIdx:] {
+			if entry != nil && !fn(entry) {
+				return
+			}
+		}
+		for _, child := range node.children {
+			if !walk(child, fn) {
+				return
+			}
+		}
+	}
+}
+
 func (rt *RadixTable) Add(prefix string, entry interface{}) error {
 	_, ipNet, err := net.ParseCIDR(prefix)
 	if err != nil {
@@ -57,50 +277,100 @@ func (rt *RadixTable) Add(prefix string, entry interface{}) error {
 }
 
 func (rt *RadixTable) AddIPNet(prefix *net.IPNet, entry interface{}) error {
-	if rt.ipBytesLen == net.IPv4len && prefix.IP.To4() == nil {
-		return errors.New("add ipv6 entry to ipv4 table")
-	} else if rt.ipBytesLen == net.IPv6len && prefix.IP.To4() != nil {
-		return errors.New("add ipv4 entry to ipv6 table")
+	return rt.insert(&Entry{
+		Prefix: prefix,
+		Entry:  entry,
+	})
+}
+
+// AddRange Add entry for every address of [start, end]. The range is stored
+// as its minimal prefix cover, each piece keeping the original range.
+func (rt *RadixTable) AddRange(start, end net.IP, entry interface{}) error {
+	start, end, err := normalizeRange(start, end)
+	if err != nil {
+		return err
+	}
+	if err = rt.checkFamily(start, "add"); err != nil {
+		return err
+	}
+	prefixes, err := rangeToCIDRs(start, end)
+	if err != nil {
+		return err
+	}
+	ipRange := &IPRange{Start: start, End: end}
+	for _, prefix := range prefixes {
+		if err = rt.insert(&Entry{Prefix: prefix, Entry: entry, Range: ipRange}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rt *RadixTable) checkFamily(ip net.IP, op string) error {
+	return checkFamily(rt.ipBytesLen, ip, op)
+}
+
+// checkFamily Check that ip fits a table of ipBytesLen addresses, 0 for both
+func checkFamily(ipBytesLen int, ip net.IP, op string) error {
+	if ipBytesLen == net.IPv4len && ip.To4() == nil {
+		return errors.New(op + " ipv6 entry to ipv4 table")
+	} else if ipBytesLen == net.IPv6len && ip.To4() != nil {
+		return errors.New(op + " ipv4 entry to ipv6 table")
+	}
+	return nil
+}
+
+func (rt *RadixTable) insert(newEntry *Entry) error {
+	prefix := newEntry.Prefix
+	if err := rt.checkFamily(prefix.IP, "add"); err != nil {
+		return err
 	}
 
 	maskSize, _ := prefix.Mask.Size()
 	if maskSize == 0 {
-		rt.defaultEntry = &Entry{
-			Prefix: prefix,
-			Entry:  entry,
-		}
+		old := rt.defaultEntry
+		rt.defaultEntry = newEntry
+		rt.changed(old, newEntry)
 		return nil
 	}
 
-	var curNode *radixNode
-	var curByte byte
+	var curNode, parent *radixNode
+	var curIdx int
 
-	byteCount := (maskSize + 7) / 8
+	levelCount, entryIdx := rt.prefixLevels(maskSize)
 	ipBytes := []byte(prefix.IP)
 
 	curNode = rt.root
 
-	// process add byte-by-byte
-	for i := 0; i < byteCount; i++ {
-		curByte = ipBytes[i]
-		if curNode.children[curByte] == nil {
-			curNode.childCnt++
-			curNode.children[curByte] = &radixNode{}
+	// process add level-by-level
+	for i := 0; i < levelCount; i++ {
+		parent = curNode
+		curIdx = rt.level(i).index(ipBytes)
+		if curNode.child(curIdx) == nil {
+			curNode.setChild(curIdx, rt.newNode(i+1))
 		}
-		curNode = curNode.children[curByte]
+		curNode = curNode.child(curIdx)
 	}
 	// save entry in end point
-	entryIdx := (maskSize + 7) % 8
 	if curNode.entries[entryIdx] == nil {
 		curNode.entryCnt++
 	}
-	curNode.entries[entryIdx] = &Entry{
-		Prefix: prefix,
-		Entry:  entry,
+	old := curNode.entries[entryIdx]
+	curNode.entries[entryIdx] = newEntry
+	if rt.precompute {
+		parent.addBest(curIdx, entryIdx+1, newEntry)
 	}
+	rt.changed(old, newEntry)
 	return nil
 }
 
+// changed Update the expiry index and the watchers after oldEntry was
+// replaced by newEntry, either being nil when a prefix is added or removed
+func (rt *RadixTable) changed(oldEntry, newEntry *Entry) {
+	rt.expiry.replace(oldEntry, newEntry)
+	rt.notify(oldEntry, newEntry)
+}
+
 func (rt *RadixTable) Delete(prefix string) error {
 	_, ipNet, err := net.ParseCIDR(prefix)
 	if err != nil {
@@ -110,88 +380,220 @@ func (rt *RadixTable) Delete(prefix string) error {
 }
 
 func (rt *RadixTable) DeleteIPNet(prefix *net.IPNet) error {
-	if rt.ipBytesLen == net.IPv4len && prefix.IP.To4() == nil {
-		return errors.New("delete ipv6 entry to ipv4 table")
-	} else if rt.ipBytesLen == net.IPv6len && prefix.IP.To4() != nil {
-		return errors.New("delete ipv4 entry to ipv6 table")
+	if err := rt.checkFamily(prefix.IP, "delete"); err != nil {
+		return err
+	}
+	if rt.sources != nil {
+		// the sources must not bring the deleted prefix back
+		rt.sources.forget(prefix)
+	}
+	if old := rt.remove(prefix); old != nil {
+		rt.changed(old, nil)
 	}
+	return nil
+}
 
+// remove Delete the entry of prefix, returning it
+func (rt *RadixTable) remove(prefix *net.IPNet) *Entry {
 	maskSize, _ := prefix.Mask.Size()
 	if maskSize == 0 {
+		old := rt.defaultEntry
 		rt.defaultEntry = nil
-		return nil
+		return old
 	}
 
 	var nodePath []*radixNode
 	var curNode *radixNode
-	var curByte byte
+	var curIdx int
 
-	byteCount := (maskSize + 7) / 8
+	levelCount, entryIdx := rt.prefixLevels(maskSize)
 	ipBytes := []byte(prefix.IP)
 
 	curNode = rt.root
 
-	// find corresponding node byte-by-byte
-	for i := 0; i < byteCount; i++ {
+	// find corresponding node level-by-level
+	for i := 0; i < levelCount; i++ {
 		nodePath = append(nodePath, curNode)
-		curByte = ipBytes[i]
-		if curNode.children[curByte] == nil {
+		curIdx = rt.level(i).index(ipBytes)
+		curNode = curNode.child(curIdx)
+		if curNode == nil {
 			return nil
 		}
-		curNode = curNode.children[curByte]
 	}
 	// delete entry from end point
-	entryIdx := (maskSize + 7) % 8
-	if curNode.entries[entryIdx] != nil {
+	old := curNode.entries[entryIdx]
+	if old != nil {
 		curNode.entryCnt--
 		curNode.entries[entryIdx] = nil
+		if rt.precompute {
+			nodePath[levelCount-1].updateBest(curIdx, entryIdx+1)
+		}
 	}
 	// free the node memory when appropriate
 	if curNode.entryCnt != 0 {
-		return nil
+		return old
+	}
+	for i := levelCount - 1; i >= 0; i-- {
+		curIdx = rt.level(i).index(ipBytes)
+		if child := nodePath[i].child(curIdx); child.childCnt == 0 && child.entryCnt == 0 {
+			nodePath[i].setChild(curIdx, nil)
+		}
+	}
+	return old
+}
+
+// DeleteRange Delete the prefixes of the minimal cover of [start, end]
+func (rt *RadixTable) DeleteRange(start, end net.IP) error {
+	start, end, err := normalizeRange(start, end)
+	if err != nil {
+		return err
+	}
+	if err = rt.checkFamily(start, "delete"); err != nil {
+		return err
+	}
+	prefixes, err := rangeToCIDRs(start, end)
+	if err != nil {
+		return err
 	}
-	for i := byteCount - 1; i >= 0; i-- {
-		curByte = ipBytes[i]
-		if nodePath[i].children[curByte].childCnt == 0 && nodePath[i].children[curByte].entryCnt == 0 {
-			nodePath[i].children[curByte] = nil
-			nodePath[i].childCnt--
+	for _, prefix := range prefixes {
+		if err = rt.DeleteIPNet(prefix); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func (rt *radixNode) lookupOneNode(val byte) *Entry {
-	preVal := val + 1
-	mask := byte(math.MaxUint8)
+func (rt *RadixTable) Get(prefix string) *Entry {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil
+	}
+	return rt.GetIPNet(ipNet)
+}
+
+// GetIPNet Return the entry of exactly prefix, without longest match
+func (rt *RadixTable) GetIPNet(prefix *net.IPNet) *Entry {
+	if rt.ipBytesLen == net.IPv4len && prefix.IP.To4() == nil ||
+		rt.ipBytesLen == net.IPv6len && prefix.IP.To4() != nil {
+		return nil
+	}
+
+	maskSize, _ := prefix.Mask.Size()
+	if maskSize == 0 {
+		return rt.defaultEntry
+	}
+
+	levelCount, entryIdx := rt.prefixLevels(maskSize)
+	ipBytes := []byte(prefix.IP)
+	curNode := rt.root
+
+	for i := 0; i < levelCount; i++ {
+		curNode = curNode.child(rt.level(i).index(ipBytes))
+		if curNode == nil {
+			return nil
+		}
+	}
+	return curNode.entries[entryIdx]
+}
+
+// span Return the child indexes covered by the first bits of idx
+func (rt *radixNode) span(idx, bits int) (first, end int) {
+	width := rt.width
+	first = idx &^ (1<<(width-bits) - 1)
+	return first, first + 1<<(width-bits)
+}
 
-	for i := 0; i < 8; i++ {
-		val &= mask
-		if val == preVal || rt.children[val] == nil {
-			preVal = val
-			mask <<= 1
+// addBest Make entry, of the first bits of idx, the best match of the
+// child indexes it covers where it is longer than the current one
+func (rt *radixNode) addBest(idx, bits int, entry *Entry) {
+	if rt.best == nil {
+		rt.best = make([]*Entry, 1<<rt.width)
+	}
+	first, end := rt.span(idx, bits)
+	maskSize, _ := entry.Prefix.Mask.Size()
+	for i := first; i < end; i++ {
+		if cur := rt.best[i]; cur != nil {
+			if curSize, _ := cur.Prefix.Mask.Size(); curSize > maskSize {
+				continue
+			}
+		}
+		rt.best[i] = entry
+	}
+}
+
+// updateBest Recompute the best matches of the child indexes covered by the
+// first bits of idx, after an entry of that length was removed
+func (rt *radixNode) updateBest(idx, bits int) {
+	first, end := rt.span(idx, bits)
+	for i := first; i < end; i++ {
+		rt.best[i] = rt.scanOneNode(i, nil, nil)
+	}
+}
+
+// lookupOneNode Return the longest entry of the node matching idx, skipping
+// entries that exclude ip or that accept, when not nil, rejects
+func (rt *radixNode) lookupOneNode(idx int, ip net.IP, accept func(entry *Entry) bool) *Entry {
+	if rt.best != nil {
+		// the precomputed entry only answers when nothing can reject it
+		if entry := rt.best[idx]; entry == nil || entry.Except == nil && accept == nil {
+			return entry
+		}
+	}
+	return rt.scanOneNode(idx, ip, accept)
+}
+
+// scanOneNode Search the entries of the children matching idx from the
+// longest prefix length down. A nil ip ignores excluded prefixes.
+func (rt *radixNode) scanOneNode(idx int, ip net.IP, accept func(entry *Entry) bool) *Entry {
+	preIdx := -1
+
+	for i := 0; i < rt.width; i++ {
+		idx &^= 1<<i - 1
+		child := rt.child(idx)
+		if idx == preIdx || child == nil {
+			preIdx = idx
 			continue
 		}
 
-		for prefixMaskSize := 7 - i; prefixMaskSize >= 0; prefixMaskSize-- {
-			if rt.children[val].entries[prefixMaskSize] != nil {
-				return rt.children[val].entries[prefixMaskSize]
+		entries := child.entries
+		for prefixMaskSize := len(entries) - 1 - i; prefixMaskSize >= 0; prefixMaskSize-- {
+			entry := entries[prefixMaskSize]
+			if entry != nil && (ip == nil || entry.Except == nil || !entry.excludes(ip)) && (accept == nil || accept(entry)) {
+				return entry
 			}
 		}
-		preVal = val
-		mask <<= 1
+		preIdx = idx
 	}
 	return nil
 }
 
 func (rt *RadixTable) Lookup(ip string) *Entry {
-	ipp := net.ParseIP(ip)
+	var buf [net.IPv6len]byte
+	ipp := parseIP(ip, &buf)
 	if ipp == nil {
 		return nil
 	}
 	return rt.LookupIP(ipp)
 }
 
+// parseIP Parse s like net.ParseIP, but into buf so that nothing is allocated
+func parseIP(s string, buf *[net.IPv6len]byte) net.IP {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || addr.Zone() != "" {
+		return nil
+	}
+	*buf = addr.As16()
+	return buf[:]
+}
+
 func (rt *RadixTable) LookupIP(ip net.IP) *Entry {
+	return rt.lookup(ip, nil)
+}
+
+// lookup Return the longest entry matching ip that accept, when not nil,
+// accepts. Rejected entries fall through to shorter prefixes. accept may
+// be called with entries shorter than the one returned.
+func (rt *RadixTable) lookup(ip net.IP, accept func(entry *Entry) bool) *Entry {
 	if rt.ipBytesLen == net.IPv4len && ip.To4() == nil ||
 		rt.ipBytesLen == net.IPv6len && ip.To4() != nil {
 		return nil
@@ -201,27 +603,32 @@ func (rt *RadixTable) LookupIP(ip net.IP) *Entry {
 	if rt.ipBytesLen == net.IPv4len {
 		ipBytes = ip.To4()
 	}
-	var nodes []*radixNode // nodes that may hit route
-	var curNode *radixNode
+	if len(ipBytes) > net.IPv6len {
+		return nil
+	}
 
-	curNode = rt.root
-	// Try to find the deepest node
-	for _, curByte := range ipBytes {
-		if curNode == nil {
+	// walk down the nodes of ip, the match of a node being longer than
+	// the matches of the nodes above it
+	var best *Entry
+	node := rt.root
+	for depth := 0; node != nil; depth++ {
+		level := rt.level(depth)
+		if level.offset >= len(ipBytes)*8 {
 			break
 		}
-		nodes = append(nodes, curNode)
-		curNode = curNode.children[curByte]
-	}
-
-	// Try to traverse the query backwards starting from the deepest node
-	for i := len(nodes) - 1; i >= 0; i-- {
-		node := nodes[i]
-		entry := node.lookupOneNode(ipBytes[i])
-		if entry != nil {
-			return entry
+		idx := level.index(ipBytes)
+		if entry := node.lookupOneNode(idx, ip, accept); entry != nil {
+			best = entry
 		}
+		node = node.child(idx)
+	}
+	if best != nil {
+		return best
 	}
 
-	return rt.defaultEntry
+	entry := rt.defaultEntry
+	if entry == nil || entry.excludes(ip) || accept != nil && !accept(entry) {
+		return nil
+	}
+	return entry
 }
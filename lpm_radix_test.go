@@ -3,6 +3,7 @@ package golpm
 import (
 	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"math/rand"
 	"net"
 	"testing"
 )
@@ -11,9 +12,7 @@ func TestRadixTable_Show(t *testing.T) {
 	var err error
 
 	Convey("Show nodes across multiple layers", t, func() {
-		table := RadixTable{
-			root: &radixNode{},
-		}
+		table := *newRadixTable(0, nil)
 		_, cidr, _ := net.ParseCIDR("0.0.0.0/0")
 		table.defaultEntry = &Entry{
 			Prefix: cidr,
@@ -21,29 +20,29 @@ func TestRadixTable_Show(t *testing.T) {
 		}
 		_, cidr, _ = net.ParseCIDR("192.0.0.0/8")
 		layer1 := table.root
-		layer1.children[192] = &radixNode{}
-		layer1.children[192].entries[7] = &Entry{
+		layer1.setChild(192, table.newNode(1))
+		layer1.child(192).entries[7] = &Entry{
 			Prefix: cidr,
 			Entry:  192,
 		}
 		_, cidr, _ = net.ParseCIDR("192.168.0.0/16")
-		layer2 := layer1.children[192]
-		layer2.children[168] = &radixNode{}
-		layer2.children[168].entries[7] = &Entry{
+		layer2 := layer1.child(192)
+		layer2.setChild(168, table.newNode(2))
+		layer2.child(168).entries[7] = &Entry{
 			Prefix: cidr,
 			Entry:  168,
 		}
 		_, cidr, _ = net.ParseCIDR("192.168.1.0/24")
-		layer3 := layer2.children[168]
-		layer3.children[1] = &radixNode{}
-		layer3.children[1].entries[7] = &Entry{
+		layer3 := layer2.child(168)
+		layer3.setChild(1, table.newNode(3))
+		layer3.child(1).entries[7] = &Entry{
 			Prefix: cidr,
 			Entry:  1,
 		}
 		_, cidr, _ = net.ParseCIDR("192.168.1.255/32")
-		layer4 := layer3.children[1]
-		layer4.children[255] = &radixNode{}
-		layer4.children[255].entries[7] = &Entry{
+		layer4 := layer3.child(1)
+		layer4.setChild(255, table.newNode(4))
+		layer4.child(255).entries[7] = &Entry{
 			Prefix: cidr,
 			Entry:  255,
 		}
@@ -78,38 +77,36 @@ func TestRadixTable_Show(t *testing.T) {
 	})
 
 	Convey("Show nodes in same layers", t, func() {
-		table := RadixTable{
-			root: &radixNode{},
-		}
+		table := *newRadixTable(0, nil)
 		layer1 := table.root
-		layer1.children[192] = &radixNode{}
-		layer2 := layer1.children[192]
-		layer2.children[168] = &radixNode{}
-		layer3 := layer2.children[168]
-		layer3.children[1] = &radixNode{}
-		layer4 := layer3.children[1]
+		layer1.setChild(192, table.newNode(1))
+		layer2 := layer1.child(192)
+		layer2.setChild(168, table.newNode(2))
+		layer3 := layer2.child(168)
+		layer3.setChild(1, table.newNode(3))
+		layer4 := layer3.child(1)
 
 		_, cidr, _ := net.ParseCIDR("192.168.1.0/32")
-		layer4.children[0] = &radixNode{}
-		layer4.children[0].entries[7] = &Entry{
+		layer4.setChild(0, table.newNode(4))
+		layer4.child(0).entries[7] = &Entry{
 			Prefix: cidr,
 			Entry:  0,
 		}
 		_, cidr, _ = net.ParseCIDR("192.168.1.7/32")
-		layer4.children[7] = &radixNode{}
-		layer4.children[7].entries[7] = &Entry{
+		layer4.setChild(7, table.newNode(4))
+		layer4.child(7).entries[7] = &Entry{
 			Prefix: cidr,
 			Entry:  7,
 		}
 		_, cidr, _ = net.ParseCIDR("192.168.1.250/32")
-		layer4.children[250] = &radixNode{}
-		layer4.children[250].entries[7] = &Entry{
+		layer4.setChild(250, table.newNode(4))
+		layer4.child(250).entries[7] = &Entry{
 			Prefix: cidr,
 			Entry:  250,
 		}
 		_, cidr, _ = net.ParseCIDR("192.168.1.255/32")
-		layer4.children[255] = &radixNode{}
-		layer4.children[255].entries[7] = &Entry{
+		layer4.setChild(255, table.newNode(4))
+		layer4.child(255).entries[7] = &Entry{
 			Prefix: cidr,
 			Entry:  255,
 		}
@@ -134,38 +131,36 @@ func TestRadixTable_Show(t *testing.T) {
 	})
 
 	Convey("Show multiple entries in same node", t, func() {
-		table := RadixTable{
-			root: &radixNode{},
-		}
+		table := *newRadixTable(0, nil)
 		layer1 := table.root
-		layer1.children[192] = &radixNode{}
-		layer2 := layer1.children[192]
-		layer2.children[168] = &radixNode{}
-		layer3 := layer2.children[168]
-		layer3.children[1] = &radixNode{}
-		layer4 := layer3.children[1]
+		layer1.setChild(192, table.newNode(1))
+		layer2 := layer1.child(192)
+		layer2.setChild(168, table.newNode(2))
+		layer3 := layer2.child(168)
+		layer3.setChild(1, table.newNode(3))
+		layer4 := layer3.child(1)
 
 		_, cidr, _ := net.ParseCIDR("192.168.1.128/25")
-		layer4.children[1] = &radixNode{}
-		layer4.children[1].entries[0] = &Entry{
+		layer4.setChild(1, table.newNode(4))
+		layer4.child(1).entries[0] = &Entry{
 			Prefix: cidr,
 			Entry:  128,
 		}
 		_, cidr, _ = net.ParseCIDR("192.168.1.224/27")
-		layer4.children[7] = &radixNode{}
-		layer4.children[7].entries[2] = &Entry{
+		layer4.setChild(7, table.newNode(4))
+		layer4.child(7).entries[2] = &Entry{
 			Prefix: cidr,
 			Entry:  224,
 		}
 		_, cidr, _ = net.ParseCIDR("192.168.1.254/31")
-		layer4.children[254] = &radixNode{}
-		layer4.children[254].entries[6] = &Entry{
+		layer4.setChild(254, table.newNode(4))
+		layer4.child(254).entries[6] = &Entry{
 			Prefix: cidr,
 			Entry:  254,
 		}
 		_, cidr, _ = net.ParseCIDR("192.168.1.255/32")
-		layer4.children[255] = &radixNode{}
-		layer4.children[255].entries[7] = &Entry{
+		layer4.setChild(255, table.newNode(4))
+		layer4.child(255).entries[7] = &Entry{
 			Prefix: cidr,
 			Entry:  255,
 		}
@@ -196,9 +191,7 @@ func TestRadixTable_Show(t *testing.T) {
 	})
 
 	Convey("Show ipv6 nodes across multiple layers", t, func() {
-		table := RadixTable{
-			root: &radixNode{},
-		}
+		table := *newRadixTable(0, nil)
 
 		ip := "2406:d440:202:f01::ffff:ffff"
 
@@ -219,9 +212,7 @@ func TestRadixTable_Show(t *testing.T) {
 	})
 
 	Convey("Show ipv6 nodes in same layers", t, func() {
-		table := RadixTable{
-			root: &radixNode{},
-		}
+		table := *newRadixTable(0, nil)
 
 		err = table.Add("2406:d440:202:f01::fff/128", "fff")
 		So(err, ShouldBeNil)
@@ -252,9 +243,7 @@ func TestRadixTable_Show(t *testing.T) {
 	})
 
 	Convey("Show multiple ipv6 entries in same node", t, func() {
-		table := RadixTable{
-			root: &radixNode{},
-		}
+		table := *newRadixTable(0, nil)
 
 		err = table.Add("2406:d440:202:fff::/64", 64)
 		So(err, ShouldBeNil)
@@ -320,9 +309,7 @@ func TestRadixTable_Add(t *testing.T) {
 	var err error
 
 	Convey("Add invalid prefix", t, func() {
-		table := RadixTable{
-			root: &radixNode{},
-		}
+		table := *newRadixTable(0, nil)
 		err = table.Add("3.3.3.3/33", 3)
 		So(err, ShouldBeError)
 		err = table.Add("1234::1::1/128", 128)
@@ -332,27 +319,19 @@ func TestRadixTable_Add(t *testing.T) {
 	})
 
 	Convey("Add ipv6 entry to ipv4 table", t, func() {
-		table := RadixTable{
-			ipBytesLen: net.IPv4len,
-			root:       &radixNode{},
-		}
+		table := *newRadixTable(net.IPv4len, nil)
 		err = table.Add("1234::1/128", 128)
 		So(err, ShouldBeError)
 	})
 
 	Convey("Add ipv4 entry to ipv6 table", t, func() {
-		table := RadixTable{
-			ipBytesLen: net.IPv6len,
-			root:       &radixNode{},
-		}
+		table := *newRadixTable(net.IPv6len, nil)
 		err = table.Add("192.168.0.1/32", 32)
 		So(err, ShouldBeError)
 	})
 
 	Convey("Add table entries of all mask len", t, func() {
-		table := RadixTable{
-			root: &radixNode{},
-		}
+		table := *newRadixTable(0, nil)
 		ip0 := "0.0.0.0"
 		ip255 := "255.255.255.255"
 		for maskLen := 0; maskLen <= 32; maskLen++ {
@@ -384,9 +363,7 @@ func TestRadixTable_Add(t *testing.T) {
 	})
 
 	Convey("Add ipv6 table entries of all mask len", t, func() {
-		table := RadixTable{
-			root: &radixNode{},
-		}
+		table := *newRadixTable(0, nil)
 
 		ip1 := "2406:d440:202:f01::ffff:ffff"
 		ipf := "ffff:ffff:fff:fff::ffff:ffff"
@@ -421,10 +398,7 @@ func TestRadixTable_Add(t *testing.T) {
 	})
 
 	Convey("Add an overlay entry", t, func() {
-		table := RadixTable{
-			ipBytesLen: net.IPv4len,
-			root:       &radixNode{},
-		}
+		table := *newRadixTable(net.IPv4len, nil)
 		err = table.Add("192.168.0.1/32", 1)
 		So(err, ShouldBeNil)
 		entries := table.Show()
@@ -436,10 +410,7 @@ func TestRadixTable_Add(t *testing.T) {
 	})
 
 	Convey("Add an overlay ipv6 entry", t, func() {
-		table := RadixTable{
-			ipBytesLen: net.IPv6len,
-			root:       &radixNode{},
-		}
+		table := *newRadixTable(net.IPv6len, nil)
 		err = table.Add("1234::1/128", 1)
 		So(err, ShouldBeNil)
 		entries := table.Show()
@@ -455,9 +426,7 @@ func TestRadixTable_Delete(t *testing.T) {
 	var err error
 
 	Convey("Delete invalid entry", t, func() {
-		table := RadixTable{
-			root: &radixNode{},
-		}
+		table := *newRadixTable(0, nil)
 
 		err = table.Delete("3.3.3.3/33")
 		So(err, ShouldBeError)
@@ -468,9 +437,7 @@ func TestRadixTable_Delete(t *testing.T) {
 	})
 
 	Convey("Delete non-exist entry", t, func() {
-		table := RadixTable{
-			root: &radixNode{},
-		}
+		table := *newRadixTable(0, nil)
 
 		err = table.Delete("1.1.1.1/32")
 		So(err, ShouldBeNil)
@@ -481,27 +448,19 @@ func TestRadixTable_Delete(t *testing.T) {
 	})
 
 	Convey("Delete ipv6 entry to ipv4 table", t, func() {
-		table := RadixTable{
-			ipBytesLen: net.IPv4len,
-			root:       &radixNode{},
-		}
+		table := *newRadixTable(net.IPv4len, nil)
 		err = table.Delete("1234::1/128")
 		So(err, ShouldBeError)
 	})
 
 	Convey("Delete ipv4 entry to ipv6 table", t, func() {
-		table := RadixTable{
-			ipBytesLen: net.IPv6len,
-			root:       &radixNode{},
-		}
+		table := *newRadixTable(net.IPv6len, nil)
 		err = table.Delete("192.168.0.1/32")
 		So(err, ShouldBeError)
 	})
 
 	Convey("Delete entry", t, func() {
-		table := RadixTable{
-			root: &radixNode{},
-		}
+		table := *newRadixTable(0, nil)
 
 		ip0 := "0.0.0.0"
 		ip255 := "255.255.255.255"
@@ -549,9 +508,7 @@ func TestRadixTable_Delete(t *testing.T) {
 	})
 
 	Convey("Delete ipv6 entry", t, func() {
-		table := RadixTable{
-			root: &radixNode{},
-		}
+		table := *newRadixTable(0, nil)
 
 		ip0 := "::"
 		ipf := "ffff:ffff:ffff::ffff:ffff:ffff"
@@ -600,10 +557,7 @@ func TestRadixTable_Delete(t *testing.T) {
 }
 
 func TestRadixTable_Lookup(t *testing.T) {
-	table := RadixTable{
-		ipBytesLen: net.IPv4len,
-		root:       &radixNode{},
-	}
+	table := *newRadixTable(net.IPv4len, nil)
 	table.Add("192.168.0.0/24", "192.168.0.0/24")
 	table.Add("192.168.0.1/32", "192.168.0.1/32")
 	table.Add("192.168.0.2/32", "192.168.0.2/32")
@@ -686,10 +640,7 @@ func TestRadixTable_Lookup(t *testing.T) {
 }
 
 func TestRadixTable_Lookup_ipv6(t *testing.T) {
-	table := RadixTable{
-		ipBytesLen: net.IPv6len,
-		root:       &radixNode{},
-	}
+	table := *newRadixTable(net.IPv6len, nil)
 	table.Add("2406:d440:202:f01::ffff:ff00/120", "2406:d440:202:f01::ffff:ff00/120")
 	table.Add("2406:d440:202:f01::ffff:ffff/128", "2406:d440:202:f01::ffff:ffff/128")
 	table.Add("2406:d440:202:f01::ffff:fffe/128", "2406:d440:202:f01::ffff:fffe/128")
@@ -757,3 +708,294 @@ func TestRadixTable_Lookup_ipv6(t *testing.T) {
 		So(entry, ShouldBeNil)
 	})
 }
+
+func TestRadixTable_Get(t *testing.T) {
+	table := *newRadixTable(net.IPv4len, nil)
+	table.Add("0.0.0.0/0", "0.0.0.0/0")
+	table.Add("10.0.0.0/8", "10.0.0.0/8")
+	table.Add("10.0.0.0/9", "10.0.0.0/9")
+	table.Add("10.0.0.0/24", "10.0.0.0/24")
+
+	Convey("Get exact prefixes", t, func() {
+		So(table.Get("0.0.0.0/0").Entry, ShouldEqual, "0.0.0.0/0")
+		So(table.Get("10.0.0.0/8").Entry, ShouldEqual, "10.0.0.0/8")
+		So(table.Get("10.0.0.0/9").Entry, ShouldEqual, "10.0.0.0/9")
+		So(table.Get("10.0.0.0/24").Entry, ShouldEqual, "10.0.0.0/24")
+	})
+
+	Convey("Get non-exist prefixes", t, func() {
+		So(table.Get("10.0.0.0/10"), ShouldBeNil)
+		So(table.Get("10.0.0.0/16"), ShouldBeNil)
+		So(table.Get("10.0.0.0/32"), ShouldBeNil)
+		So(table.Get("11.0.0.0/8"), ShouldBeNil)
+		So(table.Get("10.0.0.0/33"), ShouldBeNil)
+		So(table.Get("1234::/16"), ShouldBeNil)
+	})
+}
+
+func TestRadixTable_Walk(t *testing.T) {
+	Convey("Walk entries in prefix order", t, func() {
+		table := *newRadixTable(net.IPv4len, nil)
+		prefixes := []string{"0.0.0.0/0", "0.0.0.0/1", "0.0.0.0/8", "0.0.0.0/9", "10.0.0.0/8", "10.0.0.0/16",
+			"10.0.0.0/32", "10.0.0.1/32", "10.128.0.0/9", "128.0.0.0/1", "192.168.0.0/16"}
+		for i := len(prefixes) - 1; i >= 0; i-- {
+			table.Add(prefixes[i], i)
+		}
+
+		var walked []string
+		table.Walk(func(entry *Entry) bool {
+			walked = append(walked, entry.Prefix.String())
+			return true
+		})
+		So(walked, ShouldResemble, prefixes)
+
+		walked = nil
+		table.Walk(func(entry *Entry) bool {
+			walked = append(walked, entry.Prefix.String())
+			return len(walked) < 3
+		})
+		So(walked, ShouldResemble, prefixes[:3])
+	})
+}
+
+func TestRadixTable_LookupAllocs(t *testing.T) {
+	Convey("Parse addresses like net.ParseIP", t, func() {
+		for _, s := range []string{"192.0.2.1", "::ffff:192.0.2.1", "2001:db8::1", "::", "fe80::1%eth0",
+			"192.0.2.01", "1.2.3", "", "bad", "2001:db8::1/64"} {
+			var buf [net.IPv6len]byte
+			So(parseIP(s, &buf), ShouldResemble, net.ParseIP(s))
+		}
+	})
+
+	Convey("Look addresses up without allocating", t, func() {
+		v4 := NewRadixLPMTable(false).(*RadixTable)
+		v4.Add("10.0.0.0/8", "a")
+		v4.AddExcept("10.1.0.0/16", []string{"10.1.1.0/24"}, "b")
+		v6 := NewRadixLPMTable(true)
+		v6.Add("2001:db8::/32", "c")
+		dual := NewDualLPMTable(ArchRadix)
+		dual.Add("10.0.0.0/8", "d")
+
+		ip4, ip6 := net.ParseIP("10.1.1.1"), net.ParseIP("2001:db8::1")
+		So(testing.AllocsPerRun(100, func() { v4.LookupIP(ip4) }), ShouldEqual, 0)
+		So(testing.AllocsPerRun(100, func() { v4.Lookup("10.1.1.1") }), ShouldEqual, 0)
+		So(testing.AllocsPerRun(100, func() { v6.LookupIP(ip6) }), ShouldEqual, 0)
+		So(testing.AllocsPerRun(100, func() { v6.Lookup("2001:db8::1") }), ShouldEqual, 0)
+		So(testing.AllocsPerRun(100, func() { dual.Lookup("10.1.1.1") }), ShouldEqual, 0)
+		So(v4.Lookup("10.1.1.1").Entry, ShouldEqual, "a")
+		So(v6.Lookup("2001:db8::1").Entry, ShouldEqual, "c")
+	})
+}
+
+func TestRadixTable_PrecomputedBest(t *testing.T) {
+	Convey("Look up like the scanning table", t, func() {
+		rnd := rand.New(rand.NewSource(3))
+		for _, isIPv6 := range []bool{false, true} {
+			bits := 32
+			if isIPv6 {
+				bits = 128
+			}
+			scanning := NewRadixLPMTable(isIPv6).(*RadixTable)
+			precomputed := NewRadixLPMTable(isIPv6, WithPrecomputedBest()).(*RadixTable)
+			randomPrefix := func() *net.IPNet {
+				ip := make(net.IP, bits/8)
+				ip[0], ip[1], ip[2] = 10, byte(rnd.Intn(2)), byte(rnd.Intn(4))
+				maskLen := rnd.Intn(27)
+				return &net.IPNet{IP: ip.Mask(net.CIDRMask(maskLen, bits)), Mask: net.CIDRMask(maskLen, bits)}
+			}
+
+			for round := 0; round < 400; round++ {
+				prefix := randomPrefix()
+				switch rnd.Intn(4) {
+				case 0:
+					So(scanning.DeleteIPNet(prefix), ShouldBeNil)
+					So(precomputed.DeleteIPNet(prefix), ShouldBeNil)
+				case 1:
+					except := []*net.IPNet{randomPrefix()}
+					if scanning.AddIPNetExcept(prefix, except, round) == nil {
+						So(precomputed.AddIPNetExcept(prefix, except, round), ShouldBeNil)
+					}
+				default:
+					So(scanning.AddIPNet(prefix, round), ShouldBeNil)
+					So(precomputed.AddIPNet(prefix, round), ShouldBeNil)
+				}
+
+				for i := 0; i < 16; i++ {
+					ip := make(net.IP, bits/8)
+					ip[0], ip[1], ip[2], ip[3] = 10, byte(rnd.Intn(2)), byte(rnd.Intn(4)), byte(rnd.Intn(256))
+					want, got := scanning.LookupIP(ip), precomputed.LookupIP(ip)
+					if want == nil {
+						So(got, ShouldBeNil)
+					} else {
+						So(got, ShouldNotBeNil)
+						So(got.Entry, ShouldEqual, want.Entry)
+					}
+				}
+			}
+		}
+	})
+
+	Convey("Only allocate best match arrays on request", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		table.Add("10.0.0.0/8", "a")
+		So(table.root.best, ShouldBeNil)
+
+		table = NewRadixLPMTable(false, WithPrecomputedBest()).(*RadixTable)
+		table.Add("10.0.0.0/8", "a")
+		table.Add("10.128.0.0/9", "b")
+		So(table.root.best[10], ShouldEqual, table.Get("10.0.0.0/8"))
+		So(table.root.child(10).best[128], ShouldEqual, table.Get("10.128.0.0/9"))
+		So(table.root.child(10).best[127], ShouldBeNil)
+		table.Delete("10.128.0.0/9")
+		So(table.root.child(10).child(128), ShouldBeNil)
+		So(table.root.child(10).best[128], ShouldBeNil)
+		So(table.Lookup("10.128.0.1").Entry, ShouldEqual, "a")
+	})
+}
+
+func benchmarkLookup(b *testing.B, isIPv6 bool, opts ...RadixOption) {
+	rnd := rand.New(rand.NewSource(9))
+	table := NewRadixLPMTable(isIPv6, opts...)
+	bits := 32
+	if isIPv6 {
+		bits = 128
+	}
+	ips := make([]net.IP, 10000)
+	strs := make([]string, len(ips))
+	for i := range ips {
+		ip := make(net.IP, bits/8)
+		rnd.Read(ip)
+		if isIPv6 {
+			ip[0] = 0x20
+		}
+		maskLen := 8 + rnd.Intn(bits-7)
+		table.AddIPNet(&net.IPNet{IP: ip.Mask(net.CIDRMask(maskLen, bits)), Mask: net.CIDRMask(maskLen, bits)}, i)
+		ips[i], strs[i] = ip, ip.String()
+	}
+
+	b.Run("LookupIP", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			table.LookupIP(ips[i%len(ips)])
+		}
+	})
+	b.Run("Lookup", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			table.Lookup(strs[i%len(strs)])
+		}
+	})
+}
+
+func BenchmarkRadixTable_Lookup_ipv4(b *testing.B) {
+	benchmarkLookup(b, false)
+}
+
+func BenchmarkRadixTable_Lookup_ipv6(b *testing.B) {
+	benchmarkLookup(b, true)
+}
+
+func BenchmarkRadixTable_LookupPrecomputed_ipv4(b *testing.B) {
+	benchmarkLookup(b, false, WithPrecomputedBest())
+}
+
+func BenchmarkRadixTable_LookupPrecomputed_ipv6(b *testing.B) {
+	benchmarkLookup(b, true, WithPrecomputedBest())
+}
+
+func TestRadixTable_Strides(t *testing.T) {
+	Convey("Split addresses in levels of strides", t, func() {
+		table := NewRadixLPMTable(false, WithStrides(16, 8, 8)).(*RadixTable)
+		So(table.levels, ShouldResemble, []radixLevel{{0, 16}, {16, 8}, {24, 8}})
+		table = NewRadixLPMTable(false, WithStrides(12, 5)).(*RadixTable)
+		So(table.levels, ShouldResemble, []radixLevel{{0, 12}, {12, 5}, {17, 5}, {22, 5}, {27, 5}})
+		table = NewRadixLPMTable(true, WithStrides(16)).(*RadixTable)
+		So(len(table.levels), ShouldEqual, 8)
+		So(table.root.width, ShouldEqual, 16)
+
+		So(radixLevel{offset: 12, width: 5}.index([]byte{0xff, 0xfa, 0xbf, 0}), ShouldEqual, 0x15)
+		So(radixLevel{offset: 28, width: 8}.index([]byte{1, 2, 3, 0x4f}), ShouldEqual, 0xf0)
+
+		So(func() { WithStrides() }, ShouldPanic)
+		So(func() { WithStrides(8, 3) }, ShouldPanic)
+		So(func() { WithStrides(17) }, ShouldPanic)
+	})
+
+	Convey("Behave the same with any strides", t, func() {
+		for _, isIPv6 := range []bool{false, true} {
+			bits := 32
+			if isIPv6 {
+				bits = 128
+			}
+			tables := []LPMTable{NewRadixLPMTable(isIPv6)}
+			for _, strides := range [][]int{{4}, {16}, {16, 8, 8}, {12, 5}, {7, 9}} {
+				tables = append(tables, NewRadixLPMTable(isIPv6, WithStrides(strides...)),
+					NewRadixLPMTable(isIPv6, WithStrides(strides...), WithPrecomputedBest()))
+			}
+
+			rnd := rand.New(rand.NewSource(5))
+			randomIP := func() net.IP {
+				ip := make(net.IP, bits/8)
+				ip[0], ip[1], ip[2], ip[3] = 10, byte(rnd.Intn(2)), byte(rnd.Intn(4)), byte(rnd.Intn(256))
+				return ip
+			}
+			for round := 0; round < 300; round++ {
+				maskLen := rnd.Intn(bits + 1)
+				if maskLen > 34 {
+					maskLen = bits - rnd.Intn(3)
+				}
+				prefix := &net.IPNet{IP: randomIP().Mask(net.CIDRMask(maskLen, bits)), Mask: net.CIDRMask(maskLen, bits)}
+				remove := rnd.Intn(4) == 0
+				for _, table := range tables {
+					if remove {
+						So(table.DeleteIPNet(prefix), ShouldBeNil)
+					} else {
+						So(table.AddIPNet(prefix, round), ShouldBeNil)
+					}
+				}
+			}
+
+			want := tables[0].Show()
+			var wantWalk []string
+			tables[0].(*RadixTable).Walk(func(entry *Entry) bool {
+				wantWalk = append(wantWalk, entry.Prefix.String())
+				return true
+			})
+			for _, table := range tables[1:] {
+				So(table.Show(), ShouldResemble, want)
+				var walked []string
+				table.(*RadixTable).Walk(func(entry *Entry) bool {
+					walked = append(walked, entry.Prefix.String())
+					return true
+				})
+				So(walked, ShouldResemble, wantWalk)
+				So(Diff(tables[0], table, nil), ShouldResemble, &TableDiff{})
+			}
+			for i := 0; i < 2000; i++ {
+				ip := randomIP()
+				expected := tables[0].LookupIP(ip)
+				for _, table := range tables[1:] {
+					if got := table.LookupIP(ip); expected == nil {
+						So(got, ShouldBeNil)
+					} else {
+						So(got, ShouldNotBeNil)
+						So(got.Prefix, ShouldResemble, expected.Prefix)
+						So(got.Entry, ShouldEqual, expected.Entry)
+					}
+				}
+			}
+
+			for _, entries := range want {
+				for _, entry := range entries {
+					for _, table := range tables {
+						So(table.(PrefixGetter).GetIPNet(entry.Prefix), ShouldNotBeNil)
+						So(table.DeleteIPNet(entry.Prefix), ShouldBeNil)
+					}
+				}
+			}
+			for _, table := range tables {
+				So(table.(*RadixTable).root.childCnt, ShouldEqual, 0)
+			}
+		}
+	})
+}
@@ -0,0 +1,322 @@
+package golpm
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sort"
+)
+
+// IPRange An inclusive range of addresses of one family
+type IPRange struct {
+	Start net.IP
+	End   net.IP
+}
+
+func (r IPRange) String() string {
+	return r.Start.String() + "-" + r.End.String()
+}
+
+// Contains Report whether ip is inside the range
+func (r IPRange) Contains(ip net.IP) bool {
+	if len(r.Start) == net.IPv4len {
+		ip = ip.To4()
+	} else {
+		ip = ip.To16()
+	}
+	return len(ip) == len(r.Start) && bytes.Compare(r.Start, ip) <= 0 && bytes.Compare(ip, r.End) <= 0
+}
+
+// RangeEntry An entry reported with the address range it covers
+type RangeEntry struct {
+	Range IPRange
+	Entry interface{}
+}
+
+// normalizeRange Return start and end with the same length, 4 bytes for ipv4
+func normalizeRange(start, end net.IP) (net.IP, net.IP, error) {
+	start4, end4 := start.To4(), end.To4()
+	if start4 != nil && end4 != nil {
+		start, end = start4, end4
+	} else if start4 == nil && end4 == nil {
+		start, end = start.To16(), end.To16()
+	} else {
+		return nil, nil, errors.New("range bounds of different address families")
+	}
+	if start == nil || end == nil {
+		return nil, nil, errors.New("invalid range bound")
+	}
+	if bytes.Compare(start, end) > 0 {
+		return nil, nil, errors.New("range start after range end")
+	}
+	return start, end, nil
+}
+
+// RangesToCIDRs Return the minimal list of prefixes covering the ranges,
+// in address order with ipv4 prefixes first. Overlapping and adjacent
+// ranges are merged before being split into prefixes.
+func RangesToCIDRs(ranges ...IPRange) ([]*net.IPNet, error) {
+	var intervals []ipInterval
+	for _, r := range ranges {
+		start, end, err := normalizeRange(r.Start, r.End)
+		if err != nil {
+			return nil, err
+		}
+		intervals = append(intervals, ipInterval{start: start, end: end})
+	}
+
+	var prefixes []*net.IPNet
+	for _, interval := range sortMergeIntervals(intervals) {
+		cover, err := rangeToCIDRs(interval.start, interval.end)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, cover...)
+	}
+	return prefixes, nil
+}
+
+// CIDRsToRanges Return the ranges covered by the prefixes, in address order
+// with ipv4 ranges first. Overlapping and adjacent prefixes are merged.
+func CIDRsToRanges(prefixes ...*net.IPNet) []IPRange {
+	intervals := make([]ipInterval, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		intervals = append(intervals, prefixInterval(prefix))
+	}
+
+	var ranges []IPRange
+	for _, interval := range sortMergeIntervals(intervals) {
+		ranges = append(ranges, IPRange{Start: interval.start, End: interval.end})
+	}
+	return ranges
+}
+
+// Ranges Return the entries of table with the ranges they cover, in address
+// order. Pieces of a range added by AddRange are reported as the original
+// range, or as what is left of it when some pieces were deleted or replaced.
+func Ranges(table LPMTable) []RangeEntry {
+	var out []RangeEntry
+	pieces := make(map[*IPRange][]*net.IPNet)
+	index := make(map[*IPRange]int)
+	cursor := tableCursor(table)
+	for entry := cursor.next(); entry != nil; entry = cursor.next() {
+		if entry.Range == nil {
+			interval := prefixInterval(entry.Prefix)
+			out = append(out, RangeEntry{
+				Range: IPRange{Start: interval.start, End: interval.end},
+				Entry: entry.Entry,
+			})
+			continue
+		}
+		if _, ok := index[entry.Range]; !ok {
+			index[entry.Range] = len(out)
+			out = append(out, RangeEntry{Entry: entry.Entry})
+		}
+		pieces[entry.Range] = append(pieces[entry.Range], entry.Prefix)
+	}
+
+	for ipRange, i := range index {
+		ranges := CIDRsToRanges(pieces[ipRange]...)
+		out[i].Range = ranges[0]
+		for _, r := range ranges[1:] {
+			out = append(out, RangeEntry{Range: r, Entry: out[i].Entry})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return compareIP(out[i].Range.Start, out[j].Range.Start) < 0
+	})
+	return out
+}
+
+// rangeToCIDRs Return the minimal list of prefixes covering [start, end]
+func rangeToCIDRs(start, end net.IP) ([]*net.IPNet, error) {
+	start, end, err := normalizeRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var prefixes []*net.IPNet
+	bits := len(start) * 8
+	cur := append(net.IP(nil), start...)
+	last := make(net.IP, len(start))
+	for {
+		// grow the block while it stays aligned and inside the range
+		hostBits := 0
+		for hostBits < bits && ipHostBitsZero(cur, hostBits+1) {
+			setIPHostBits(last, cur, hostBits+1)
+			if bytes.Compare(last, end) > 0 {
+				break
+			}
+			hostBits++
+		}
+		setIPHostBits(last, cur, hostBits)
+		prefixes = append(prefixes, &net.IPNet{
+			IP:   append(net.IP(nil), cur...),
+			Mask: net.CIDRMask(bits-hostBits, bits),
+		})
+		if bytes.Equal(last, end) {
+			return prefixes, nil
+		}
+		copy(cur, last)
+		incrementIP(cur)
+	}
+}
+
+// ipHostBitsZero Report whether the lowest hostBits bits of ip are zero
+func ipHostBitsZero(ip net.IP, hostBits int) bool {
+	for i := len(ip) - 1; i >= 0 && hostBits > 0; i-- {
+		mask := byte(0xff)
+		if hostBits < 8 {
+			mask = byte(1<<hostBits - 1)
+		}
+		if ip[i]&mask != 0 {
+			return false
+		}
+		hostBits -= 8
+	}
+	return true
+}
+
+// setIPHostBits Set dst to ip with the lowest hostBits bits set to one
+func setIPHostBits(dst, ip net.IP, hostBits int) {
+	copy(dst, ip)
+	for i := len(dst) - 1; i >= 0 && hostBits > 0; i-- {
+		if hostBits < 8 {
+			dst[i] |= byte(1<<hostBits - 1)
+		} else {
+			dst[i] = 0xff
+		}
+		hostBits -= 8
+	}
+}
+
+// incrementIP Add one to ip in place, wrapping around at the top
+func incrementIP(ip net.IP) {
+	for i := len(ip) - 1; i >= 0; i-- {
+		ip[i]++
+		if ip[i] != 0 {
+			return
+		}
+	}
+}
+
+// decrementIP Subtract one from ip in place, wrapping around at the bottom
+func decrementIP(ip net.IP) {
+	for i := len(ip) - 1; i >= 0; i-- {
+		ip[i]--
+		if ip[i] != 0xff {
+			return
+		}
+	}
+}
+
+// ipInterval An inclusive range of addresses of one family
+type ipInterval struct {
+	start net.IP
+	end   net.IP
+}
+
+// prefixInterval Return the range covered by prefix
+func prefixInterval(prefix *net.IPNet) ipInterval {
+	maskSize, bits := prefix.Mask.Size()
+	ip := prefix.IP
+	if bits == 8*net.IPv4len {
+		ip = ip.To4()
+	}
+	end := make(net.IP, len(ip))
+	setIPHostBits(end, ip, bits-maskSize)
+	return ipInterval{
+		start: append(net.IP(nil), ip...),
+		end:   end,
+	}
+}
+
+// mergeIntervals Merge overlapping and adjacent ranges sorted by start
+func mergeIntervals(intervals []ipInterval) []ipInterval {
+	var merged []ipInterval
+	for _, interval := range intervals {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			next := append(net.IP(nil), last.end...)
+			incrementIP(next)
+			if bytes.Compare(interval.start, next) <= 0 || isMaxIP(last.end) {
+				if bytes.Compare(interval.end, last.end) > 0 {
+					last.end = interval.end
+				}
+				continue
+			}
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
+
+// sortMergeIntervals Sort ranges of both families, ipv4 first, and merge them
+func sortMergeIntervals(intervals []ipInterval) []ipInterval {
+	sort.Slice(intervals, func(i, j int) bool {
+		return compareIP(intervals[i].start, intervals[j].start) < 0
+	})
+	var merged []ipInterval
+	for i := 0; i < len(intervals); {
+		j := i
+		for j < len(intervals) && len(intervals[j].start) == len(intervals[i].start) {
+			j++
+		}
+		merged = append(merged, mergeIntervals(intervals[i:j])...)
+		i = j
+	}
+	return merged
+}
+
+// intersectIntervals Return the ranges covered by both a and b
+func intersectIntervals(a, b []ipInterval) []ipInterval {
+	var out []ipInterval
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start, end := a[i].start, a[i].end
+		if bytes.Compare(b[j].start, start) > 0 {
+			start = b[j].start
+		}
+		if bytes.Compare(b[j].end, end) < 0 {
+			end = b[j].end
+		}
+		if bytes.Compare(start, end) <= 0 {
+			out = append(out, ipInterval{start: start, end: end})
+		}
+		if bytes.Compare(a[i].end, b[j].end) < 0 {
+			i++
+		} else {
+			j++
+		}
+	}
+	return out
+}
+
+// complementIntervals Return the ranges of addresses of ipLen bytes not in intervals
+func complementIntervals(intervals []ipInterval, ipLen int) []ipInterval {
+	var out []ipInterval
+	next := make(net.IP, ipLen)
+	for _, interval := range intervals {
+		if bytes.Compare(next, interval.start) < 0 {
+			end := append(net.IP(nil), interval.start...)
+			decrementIP(end)
+			out = append(out, ipInterval{start: next, end: end})
+		}
+		if isMaxIP(interval.end) {
+			return out
+		}
+		next = append(net.IP(nil), interval.end...)
+		incrementIP(next)
+	}
+	last := make(net.IP, ipLen)
+	setIPHostBits(last, last, ipLen*8)
+	return append(out, ipInterval{start: next, end: last})
+}
+
+func isMaxIP(ip net.IP) bool {
+	for _, b := range ip {
+		if b != 0xff {
+			return false
+		}
+	}
+	return true
+}
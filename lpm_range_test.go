@@ -0,0 +1,144 @@
+package golpm
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func cidrStrings(prefixes []*net.IPNet) []string {
+	var s []string
+	for _, prefix := range prefixes {
+		s = append(s, prefix.String())
+	}
+	return s
+}
+
+func TestRangeToCIDRs(t *testing.T) {
+	Convey("Split ipv4 ranges", t, func() {
+		prefixes, err := rangeToCIDRs(net.ParseIP("1.2.3.7"), net.ParseIP("1.2.4.10"))
+		So(err, ShouldBeNil)
+		So(cidrStrings(prefixes), ShouldResemble, []string{
+			"1.2.3.7/32", "1.2.3.8/29", "1.2.3.16/28", "1.2.3.32/27", "1.2.3.64/26", "1.2.3.128/25",
+			"1.2.4.0/29", "1.2.4.8/31", "1.2.4.10/32",
+		})
+
+		prefixes, err = rangeToCIDRs(net.ParseIP("0.0.0.0"), net.ParseIP("255.255.255.255"))
+		So(err, ShouldBeNil)
+		So(cidrStrings(prefixes), ShouldResemble, []string{"0.0.0.0/0"})
+
+		prefixes, err = rangeToCIDRs(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.1"))
+		So(err, ShouldBeNil)
+		So(cidrStrings(prefixes), ShouldResemble, []string{"10.0.0.1/32"})
+	})
+
+	Convey("Split ipv6 ranges", t, func() {
+		prefixes, err := rangeToCIDRs(net.ParseIP("2001:db8::"), net.ParseIP("2001:db8::1:ffff"))
+		So(err, ShouldBeNil)
+		So(cidrStrings(prefixes), ShouldResemble, []string{"2001:db8::/111"})
+
+		prefixes, err = rangeToCIDRs(net.ParseIP("::"), net.ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"))
+		So(err, ShouldBeNil)
+		So(cidrStrings(prefixes), ShouldResemble, []string{"::/0"})
+	})
+
+	Convey("Split invalid ranges", t, func() {
+		_, err := rangeToCIDRs(net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1"))
+		So(err, ShouldBeError)
+		_, err = rangeToCIDRs(net.ParseIP("10.0.0.2"), net.ParseIP("2001:db8::"))
+		So(err, ShouldBeError)
+	})
+}
+
+func rangeStrings(ranges []IPRange) []string {
+	var s []string
+	for _, r := range ranges {
+		s = append(s, r.String())
+	}
+	return s
+}
+
+func TestRangesToCIDRs(t *testing.T) {
+	Convey("Merge ranges before splitting them", t, func() {
+		prefixes, err := RangesToCIDRs(
+			IPRange{Start: net.ParseIP("2001:db8::"), End: net.ParseIP("2001:db8::ff")},
+			IPRange{Start: net.ParseIP("10.0.0.128"), End: net.ParseIP("10.0.0.255")},
+			IPRange{Start: net.ParseIP("10.0.0.0"), End: net.ParseIP("10.0.0.127")},
+			IPRange{Start: net.ParseIP("10.0.0.16"), End: net.ParseIP("10.0.1.0")},
+		)
+		So(err, ShouldBeNil)
+		So(cidrStrings(prefixes), ShouldResemble, []string{"10.0.0.0/24", "10.0.1.0/32", "2001:db8::/120"})
+
+		_, err = RangesToCIDRs(IPRange{Start: net.ParseIP("10.0.0.2"), End: net.ParseIP("10.0.0.1")})
+		So(err, ShouldBeError)
+	})
+
+	Convey("Coalesce prefixes into ranges", t, func() {
+		var prefixes []*net.IPNet
+		for _, s := range []string{"2001:db8::/33", "10.0.1.0/24", "10.0.0.0/24", "10.0.0.128/25", "10.0.3.0/24", "2001:db8:8000::/33"} {
+			_, prefix, _ := net.ParseCIDR(s)
+			prefixes = append(prefixes, prefix)
+		}
+		So(rangeStrings(CIDRsToRanges(prefixes...)), ShouldResemble, []string{
+			"10.0.0.0-10.0.1.255", "10.0.3.0-10.0.3.255", "2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff",
+		})
+		So(CIDRsToRanges(), ShouldBeEmpty)
+	})
+
+	Convey("Round trip through both helpers", t, func() {
+		r := IPRange{Start: net.ParseIP("1.2.3.7").To4(), End: net.ParseIP("1.2.4.10").To4()}
+		prefixes, err := RangesToCIDRs(r)
+		So(err, ShouldBeNil)
+		So(rangeStrings(CIDRsToRanges(prefixes...)), ShouldResemble, []string{r.String()})
+		So(r.Contains(net.ParseIP("1.2.3.200")), ShouldBeTrue)
+		So(r.Contains(net.ParseIP("1.2.4.11")), ShouldBeFalse)
+		So(r.Contains(net.ParseIP("2001:db8::")), ShouldBeFalse)
+	})
+}
+
+func TestRanges(t *testing.T) {
+	Convey("Report the ranges of a table", t, func() {
+		table := NewDualLPMTable(ArchRadix)
+		So(table.AddRange(net.ParseIP("1.2.3.7"), net.ParseIP("1.2.4.10"), "a"), ShouldBeNil)
+		So(table.Add("1.2.0.0/16", "b"), ShouldBeNil)
+		So(table.AddRange(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::6"), "c"), ShouldBeNil)
+
+		So(table.Lookup("1.2.3.6").Entry, ShouldEqual, "b")
+		So(table.Lookup("1.2.3.7").Entry, ShouldEqual, "a")
+		So(table.Lookup("1.2.4.10").Entry, ShouldEqual, "a")
+		So(table.Lookup("1.2.4.11").Entry, ShouldEqual, "b")
+		So(table.Lookup("1.2.3.100").Range.String(), ShouldEqual, "1.2.3.7-1.2.4.10")
+		So(table.Lookup("2001:db8::7"), ShouldBeNil)
+
+		So(Ranges(table), ShouldResemble, []RangeEntry{
+			{Range: IPRange{Start: net.ParseIP("1.2.0.0").To4(), End: net.ParseIP("1.2.255.255").To4()}, Entry: "b"},
+			{Range: IPRange{Start: net.ParseIP("1.2.3.7").To4(), End: net.ParseIP("1.2.4.10").To4()}, Entry: "a"},
+			{Range: IPRange{Start: net.ParseIP("2001:db8::1"), End: net.ParseIP("2001:db8::6")}, Entry: "c"},
+		})
+		So(len(table.Show()[32]), ShouldEqual, 2)
+		So(table.Show()[32][0].Range.String(), ShouldEqual, "1.2.3.7-1.2.4.10")
+
+		Convey("Report what is left of a partially deleted range", func() {
+			So(table.Delete("1.2.3.128/25"), ShouldBeNil)
+			ranges := Ranges(table)
+			So(len(ranges), ShouldEqual, 4)
+			So(ranges[1].Range.String(), ShouldEqual, "1.2.3.7-1.2.3.127")
+			So(ranges[2].Range.String(), ShouldEqual, "1.2.4.0-1.2.4.10")
+			So(ranges[2].Entry, ShouldEqual, "a")
+		})
+
+		Convey("Delete a range", func() {
+			So(table.DeleteRange(net.ParseIP("1.2.3.7"), net.ParseIP("1.2.4.10")), ShouldBeNil)
+			So(table.Lookup("1.2.3.7").Entry, ShouldEqual, "b")
+			So(len(Ranges(table)), ShouldEqual, 2)
+			So(table.DeleteRange(net.ParseIP("1.2.3.7"), net.ParseIP("2001:db8::")), ShouldBeError)
+		})
+
+		Convey("Reject ranges of the wrong family", func() {
+			v4 := NewRadixLPMTable(false)
+			So(v4.AddRange(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::6"), "c"), ShouldBeError)
+			So(len(v4.Show()), ShouldEqual, 0)
+		})
+	})
+}
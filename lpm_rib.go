@@ -0,0 +1,225 @@
+package golpm
+
+import (
+	"net"
+	"sort"
+)
+
+// Route A candidate route of a RIB prefix. A source has at most one
+// candidate per prefix.
+type Route struct {
+	Source   string
+	Distance int // administrative distance
+	Metric   int
+	Value    interface{}
+}
+
+// RouteLess Report whether route a is preferred over route b
+type RouteLess func(a, b *Route) bool
+
+// DefaultRouteLess Prefer the lower distance, then the lower metric, then
+// the lower source name so that the choice is stable
+func DefaultRouteLess(a, b *Route) bool {
+	if a.Distance != b.Distance {
+		return a.Distance < b.Distance
+	}
+	if a.Metric != b.Metric {
+		return a.Metric < b.Metric
+	}
+	return a.Source < b.Source
+}
+
+// RIBChange A change of the best route of a prefix. Old is nil when the
+// prefix had no route and New is nil when its last route was withdrawn.
+type RIBChange struct {
+	Prefix *net.IPNet
+	Old    *Route
+	New    *Route
+}
+
+// RIB A routing information base holding several candidate routes per
+// prefix, the best of which is installed in a dual-family lpm table.
+type RIB struct {
+	table    *DualTable
+	prefixes map[string]*ribPrefix
+	less     RouteLess
+	// OnChange is called after the best route of a prefix changed
+	OnChange func(change RIBChange)
+}
+
+type ribPrefix struct {
+	prefix *net.IPNet
+	routes []*Route // best first
+}
+
+// NewRIB Create an empty RIB ordering candidates with less,
+// DefaultRouteLess when nil
+func NewRIB(less RouteLess) *RIB {
+	if less == nil {
+		less = DefaultRouteLess
+	}
+	return &RIB{
+		table:    NewDualLPMTable(ArchRadix),
+		prefixes: make(map[string]*ribPrefix),
+		less:     less,
+	}
+}
+
+// Table Return the lpm table of best routes, entries are *Route
+func (rib *RIB) Table() LPMTable {
+	return rib.table
+}
+
+// Announce Add route as a candidate for prefix, replacing the previous
+// candidate of the same source
+func (rib *RIB) Announce(prefix string, route *Route) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return rib.AnnounceIPNet(ipNet, route)
+}
+
+func (rib *RIB) AnnounceIPNet(prefix *net.IPNet, route *Route) error {
+	prefix = &net.IPNet{IP: prefix.IP.Mask(prefix.Mask), Mask: prefix.Mask}
+	key := prefix.String()
+	rp := rib.prefixes[key]
+	if rp == nil {
+		rp = &ribPrefix{prefix: prefix}
+	}
+
+	routes := make([]*Route, 0, len(rp.routes)+1)
+	for _, r := range rp.routes {
+		if r.Source != route.Source {
+			routes = append(routes, r)
+		}
+	}
+	routes = append(routes, route)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return rib.less(routes[i], routes[j])
+	})
+	return rib.update(key, rp, routes)
+}
+
+// Withdraw Remove the candidate of source for prefix, promoting the next
+// best candidate when it was the best one
+func (rib *RIB) Withdraw(prefix string, source string) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return rib.WithdrawIPNet(ipNet, source)
+}
+
+func (rib *RIB) WithdrawIPNet(prefix *net.IPNet, source string) error {
+	prefix = &net.IPNet{IP: prefix.IP.Mask(prefix.Mask), Mask: prefix.Mask}
+	key := prefix.String()
+	rp := rib.prefixes[key]
+	if rp == nil {
+		return nil
+	}
+
+	var routes []*Route
+	for _, r := range rp.routes {
+		if r.Source != source {
+			routes = append(routes, r)
+		}
+	}
+	return rib.update(key, rp, routes)
+}
+
+// WithdrawSource Remove every candidate of source
+func (rib *RIB) WithdrawSource(source string) error {
+	var prefixes []*net.IPNet
+	for _, rp := range rib.prefixes {
+		for _, r := range rp.routes {
+			if r.Source == source {
+				prefixes = append(prefixes, rp.prefix)
+				break
+			}
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return comparePrefix(prefixes[i], prefixes[j]) < 0
+	})
+	for _, prefix := range prefixes {
+		if err := rib.WithdrawIPNet(prefix, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update Replace the candidates of a prefix, installing the new best route
+func (rib *RIB) update(key string, rp *ribPrefix, routes []*Route) error {
+	var oldBest, newBest *Route
+	if len(rp.routes) > 0 {
+		oldBest = rp.routes[0]
+	}
+	if len(routes) > 0 {
+		newBest = routes[0]
+	}
+
+	if newBest != oldBest {
+		var err error
+		if newBest == nil {
+			err = rib.table.DeleteIPNet(rp.prefix)
+		} else {
+			err = rib.table.AddIPNet(rp.prefix, newBest)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	rp.routes = routes
+	if len(routes) == 0 {
+		delete(rib.prefixes, key)
+	} else {
+		rib.prefixes[key] = rp
+	}
+
+	if newBest != oldBest && rib.OnChange != nil {
+		rib.OnChange(RIBChange{Prefix: rp.prefix, Old: oldBest, New: newBest})
+	}
+	return nil
+}
+
+// Routes Return the candidates of prefix, best first
+func (rib *RIB) Routes(prefix string) []*Route {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil
+	}
+	rp := rib.prefixes[ipNet.String()]
+	if rp == nil {
+		return nil
+	}
+	return append([]*Route(nil), rp.routes...)
+}
+
+// Best Return the best route of exactly prefix
+func (rib *RIB) Best(prefix string) *Route {
+	routes := rib.Routes(prefix)
+	if len(routes) == 0 {
+		return nil
+	}
+	return routes[0]
+}
+
+func (rib *RIB) Lookup(ip string) *Route {
+	ipp := net.ParseIP(ip)
+	if ipp == nil {
+		return nil
+	}
+	return rib.LookupIP(ipp)
+}
+
+// LookupIP Return the best route of the longest prefix matching ip
+func (rib *RIB) LookupIP(ip net.IP) *Route {
+	entry := rib.table.LookupIP(ip)
+	if entry == nil {
+		return nil
+	}
+	return entry.Entry.(*Route)
+}
@@ -0,0 +1,86 @@
+package golpm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRIB(t *testing.T) {
+	Convey("Select the best candidate of each prefix", t, func() {
+		rib := NewRIB(nil)
+		var changes []RIBChange
+		rib.OnChange = func(change RIBChange) {
+			changes = append(changes, change)
+		}
+
+		ospf := &Route{Source: "ospf", Distance: 110, Metric: 20, Value: "10.255.0.1"}
+		bgp := &Route{Source: "bgp", Distance: 20, Value: "192.0.2.1"}
+		static := &Route{Source: "static", Distance: 1, Value: "10.255.0.9"}
+		So(rib.Announce("10.0.0.0/8", ospf), ShouldBeNil)
+		So(rib.Announce("10.0.0.0/8", bgp), ShouldBeNil)
+		So(rib.Announce("10.1.0.0/16", ospf), ShouldBeNil)
+		So(rib.Announce("2001:db8::/32", static), ShouldBeNil)
+
+		So(rib.Lookup("10.2.0.1"), ShouldEqual, bgp)
+		So(rib.Lookup("10.1.0.1"), ShouldEqual, ospf)
+		So(rib.Lookup("2001:db8::1"), ShouldEqual, static)
+		So(rib.Lookup("192.0.2.1"), ShouldBeNil)
+		So(rib.Routes("10.0.0.0/8"), ShouldResemble, []*Route{bgp, ospf})
+		So(rib.Best("10.1.0.0/16"), ShouldEqual, ospf)
+		So(rib.Table().(PrefixGetter).Get("10.0.0.0/8").Entry, ShouldEqual, bgp)
+
+		So(len(changes), ShouldEqual, 4)
+		So(changes[1].Prefix.String(), ShouldEqual, "10.0.0.0/8")
+		So(changes[1].Old, ShouldEqual, ospf)
+		So(changes[1].New, ShouldEqual, bgp)
+
+		Convey("Promote the next candidate on withdraw", func() {
+			changes = nil
+			So(rib.Withdraw("10.0.0.0/8", "bgp"), ShouldBeNil)
+			So(rib.Lookup("10.2.0.1"), ShouldEqual, ospf)
+			So(changes, ShouldResemble, []RIBChange{{Prefix: changes[0].Prefix, Old: bgp, New: ospf}})
+
+			So(rib.Withdraw("10.0.0.0/8", "ospf"), ShouldBeNil)
+			So(rib.Lookup("10.2.0.1"), ShouldBeNil)
+			So(rib.Routes("10.0.0.0/8"), ShouldBeNil)
+			So(changes[1].New, ShouldBeNil)
+		})
+
+		Convey("Withdraw a candidate that is not the best", func() {
+			changes = nil
+			So(rib.Withdraw("10.0.0.0/8", "ospf"), ShouldBeNil)
+			So(rib.Withdraw("10.9.0.0/16", "ospf"), ShouldBeNil)
+			So(rib.Routes("10.0.0.0/8"), ShouldResemble, []*Route{bgp})
+			So(changes, ShouldBeEmpty)
+		})
+
+		Convey("Replace the candidate of a source", func() {
+			changes = nil
+			better := &Route{Source: "ospf", Distance: 110, Metric: 10, Value: "10.255.0.2"}
+			So(rib.Announce("10.1.0.0/16", better), ShouldBeNil)
+			So(rib.Routes("10.1.0.0/16"), ShouldResemble, []*Route{better})
+			So(changes[0].Old, ShouldEqual, ospf)
+			So(changes[0].New, ShouldEqual, better)
+		})
+
+		Convey("Withdraw every candidate of a source", func() {
+			So(rib.WithdrawSource("ospf"), ShouldBeNil)
+			So(rib.Lookup("10.1.0.1"), ShouldEqual, bgp)
+			So(rib.Routes("10.0.0.0/8"), ShouldResemble, []*Route{bgp})
+		})
+	})
+
+	Convey("Order candidates with a custom comparator", t, func() {
+		rib := NewRIB(func(a, b *Route) bool {
+			return a.Metric > b.Metric
+		})
+		low := &Route{Source: "a", Metric: 1}
+		high := &Route{Source: "b", Metric: 5}
+		rib.Announce("10.0.0.1/8", low)
+		rib.Announce("10.0.0.0/8", high)
+		So(rib.Lookup("10.0.0.1"), ShouldEqual, high)
+		So(len(rib.Routes("10.0.0.0/8")), ShouldEqual, 2)
+		So(rib.Announce("bad", low), ShouldBeError)
+	})
+}
@@ -0,0 +1,168 @@
+package golpm
+
+import (
+	"fmt"
+	"net"
+)
+
+// RouteType The kind of a route, after the Linux route types
+type RouteType int
+
+const (
+	// RouteUnicast A regular route, the type of entries added by Add
+	RouteUnicast RouteType = iota
+	// RouteBlackhole Matching packets are silently discarded
+	RouteBlackhole
+	// RouteUnreachable Matching destinations are unreachable
+	RouteUnreachable
+	// RouteProhibit Matching destinations are administratively prohibited
+	RouteProhibit
+	// RouteThrow The lookup continues in the fallback table
+	RouteThrow
+)
+
+func (rt RouteType) String() string {
+	switch rt {
+	case RouteUnicast:
+		return "unicast"
+	case RouteBlackhole:
+		return "blackhole"
+	case RouteUnreachable:
+		return "unreachable"
+	case RouteProhibit:
+		return "prohibit"
+	case RouteThrow:
+		return "throw"
+	}
+	return "unknown"
+}
+
+// MarshalText Encode the route type as its name, failing on unknown types
+func (rt RouteType) MarshalText() ([]byte, error) {
+	if rt < RouteUnicast || rt > RouteThrow {
+		return nil, fmt.Errorf("unknown route type %d", int(rt))
+	}
+	return []byte(rt.String()), nil
+}
+
+// UnmarshalText Decode a route type from the name given by String
+func (rt *RouteType) UnmarshalText(text []byte) error {
+	for t := RouteUnicast; t <= RouteThrow; t++ {
+		if t.String() == string(text) {
+			*rt = t
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown route type %q", text)
+}
+
+// LookupResult The result of a route lookup. Entry is the matched entry and
+// Type its route type; Found is false when no entry matches, or when a throw
+// route matches and no fallback table resolves the address.
+type LookupResult struct {
+	Entry *Entry
+	Type  RouteType
+	Found bool
+}
+
+// Deliverable Report whether the lookup found a unicast route
+func (lr LookupResult) Deliverable() bool {
+	return lr.Found && lr.Type == RouteUnicast
+}
+
+// TypedAdder A lpm table storing a route type with its entries.
+// The tables of this package implement it.
+type TypedAdder interface {
+	AddTyped(prefix string, typ RouteType, entry interface{}) error
+	AddIPNetTyped(prefix *net.IPNet, typ RouteType, entry interface{}) error
+}
+
+// RouteTable A lpm table looking up route types and following throw routes.
+// The tables of this package implement it.
+type RouteTable interface {
+	LookupRoute(ip string) LookupResult
+	LookupRouteIP(ip net.IP) LookupResult
+}
+
+// addIPNetTyped Add entry of route type typ to table, which must implement
+// TypedAdder unless typ is RouteUnicast
+func addIPNetTyped(table LPMTable, prefix *net.IPNet, typ RouteType, entry interface{}) error {
+	if adder, ok := table.(TypedAdder); ok {
+		return adder.AddIPNetTyped(prefix, typ, entry)
+	}
+	if typ != RouteUnicast {
+		return fmt.Errorf("%T does not support %s routes", table, typ)
+	}
+	return table.AddIPNet(prefix, entry)
+}
+
+// lookupRouteIP Look ip up in table, through LookupRouteIP when the table
+// implements it
+func lookupRouteIP(table LPMTable, ip net.IP) LookupResult {
+	if routes, ok := table.(RouteTable); ok {
+		return routes.LookupRouteIP(ip)
+	}
+	entry := table.LookupIP(ip)
+	if entry == nil {
+		return LookupResult{}
+	}
+	return LookupResult{Entry: entry, Type: entry.Type, Found: true}
+}
+
+// AddTyped Add an entry of the given route type for prefix
+func (rt *RadixTable) AddTyped(prefix string, typ RouteType, entry interface{}) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return rt.AddIPNetTyped(ipNet, typ, entry)
+}
+
+func (rt *RadixTable) AddIPNetTyped(prefix *net.IPNet, typ RouteType, entry interface{}) error {
+	return rt.insert(&Entry{
+		Prefix: prefix,
+		Entry:  entry,
+		Type:   typ,
+	})
+}
+
+// SetFallback Set the table a throw route continues the lookup in, nil for
+// none. The fallback must not lead back to the table.
+func (rt *RadixTable) SetFallback(table LPMTable) {
+	rt.fallback = table
+}
+
+func (rt *RadixTable) LookupRoute(ip string) LookupResult {
+	ipp := net.ParseIP(ip)
+	if ipp == nil {
+		return LookupResult{}
+	}
+	return rt.LookupRouteIP(ipp)
+}
+
+// LookupRouteIP Return the longest match of ip with its route type. Unlike
+// LookupIP, which returns throw entries as they are, a throw route makes the
+// lookup continue in the fallback table.
+func (rt *RadixTable) LookupRouteIP(ip net.IP) LookupResult {
+	entry := rt.LookupIP(ip)
+	if entry == nil {
+		return LookupResult{}
+	}
+	if entry.Type == RouteThrow && rt.fallback != nil {
+		return lookupRouteIP(rt.fallback, ip)
+	}
+	return LookupResult{
+		Entry: entry,
+		Type:  entry.Type,
+		Found: entry.Type != RouteThrow,
+	}
+}
+
+// SetFallback Set the fallback table of both families
+func (dt *DualTable) SetFallback(table LPMTable) {
+	for _, t := range []LPMTable{dt.V4, dt.V6} {
+		if t, ok := t.(interface{ SetFallback(table LPMTable) }); ok {
+			t.SetFallback(table)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package golpm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRadixTable_LookupRoute(t *testing.T) {
+	Convey("Stop lookups at typed routes", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		So(table.Add("0.0.0.0/0", "default"), ShouldBeNil)
+		So(table.Add("10.0.0.0/8", "private"), ShouldBeNil)
+		So(table.AddTyped("10.1.0.0/16", RouteBlackhole, nil), ShouldBeNil)
+		So(table.AddTyped("10.2.0.0/16", RouteUnreachable, nil), ShouldBeNil)
+		So(table.AddTyped("10.3.0.0/16", RouteProhibit, "policy"), ShouldBeNil)
+		So(table.Add("10.1.1.0/24", "hole"), ShouldBeNil)
+
+		result := table.LookupRoute("10.0.0.1")
+		So(result.Found, ShouldBeTrue)
+		So(result.Deliverable(), ShouldBeTrue)
+		So(result.Entry.Entry, ShouldEqual, "private")
+
+		result = table.LookupRoute("10.1.0.1")
+		So(result.Found, ShouldBeTrue)
+		So(result.Deliverable(), ShouldBeFalse)
+		So(result.Type, ShouldEqual, RouteBlackhole)
+		So(result.Entry.Prefix.String(), ShouldEqual, "10.1.0.0/16")
+		So(table.LookupRoute("10.1.1.1").Entry.Entry, ShouldEqual, "hole")
+		So(table.LookupRoute("10.2.0.1").Type, ShouldEqual, RouteUnreachable)
+		So(table.LookupRoute("10.3.0.1").Type, ShouldEqual, RouteProhibit)
+		So(table.LookupRoute("10.3.0.1").Entry.Entry, ShouldEqual, "policy")
+		So(table.LookupRoute("bad").Found, ShouldBeFalse)
+
+		// plain lookups return typed entries as they are
+		So(table.Lookup("10.2.0.1").Type, ShouldEqual, RouteUnreachable)
+		So(table.Lookup("10.0.0.1").Type, ShouldEqual, RouteUnicast)
+		So(RouteProhibit.String(), ShouldEqual, "prohibit")
+	})
+
+	Convey("Continue lookups of throw routes in the fallback table", t, func() {
+		main := NewRadixLPMTable(false).(*RadixTable)
+		main.Add("0.0.0.0/0", "main default")
+		main.Add("192.168.0.0/16", "main lan")
+
+		vrf := NewRadixLPMTable(false).(*RadixTable)
+		vrf.Add("10.0.0.0/8", "vrf")
+		vrf.AddTyped("10.9.0.0/16", RouteThrow, nil)
+		vrf.AddTyped("192.168.0.0/16", RouteThrow, nil)
+
+		result := vrf.LookupRoute("192.168.1.1")
+		So(result.Found, ShouldBeFalse)
+		So(result.Type, ShouldEqual, RouteThrow)
+		So(vrf.Lookup("192.168.1.1").Type, ShouldEqual, RouteThrow)
+
+		vrf.SetFallback(main)
+		So(vrf.LookupRoute("10.1.0.1").Entry.Entry, ShouldEqual, "vrf")
+		So(vrf.LookupRoute("10.9.0.1").Entry.Entry, ShouldEqual, "main default")
+		So(vrf.LookupRoute("192.168.1.1").Entry.Entry, ShouldEqual, "main lan")
+		So(vrf.LookupRoute("8.8.8.8").Found, ShouldBeFalse)
+	})
+
+	Convey("Route types in a dual-family table", t, func() {
+		table := NewDualLPMTable(ArchRadix)
+		table.AddTyped("2001:db8::/32", RouteThrow, nil)
+		table.AddTyped("10.0.0.0/8", RouteThrow, nil)
+		fallback := NewDualLPMTable(ArchRadix)
+		fallback.Add("2001:db8::/48", "v6")
+		fallback.Add("10.0.0.0/16", "v4")
+		table.SetFallback(fallback)
+
+		So(table.LookupRoute("2001:db8::1").Entry.Entry, ShouldEqual, "v6")
+		So(table.LookupRoute("10.0.0.1").Entry.Entry, ShouldEqual, "v4")
+		So(table.LookupRoute("10.1.0.1").Found, ShouldBeFalse)
+	})
+
+	Convey("Keep route types when rewriting tables", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		table.Add("10.0.0.0/25", "x")
+		table.AddTyped("10.0.0.128/25", RouteBlackhole, "x")
+
+		So(tableSize(table.Aggregate(nil)), ShouldEqual, 2)
+		So(table.Aggregate(nil).Lookup("10.0.0.200").Type, ShouldEqual, RouteBlackhole)
+		So(tableSize(table.MergeSiblings(nil)), ShouldEqual, 2)
+
+		other := NewRadixLPMTable(false)
+		other.Add("10.0.0.0/25", "x")
+		other.Add("10.0.0.128/25", "x")
+		So(len(Diff(table, other, nil).Changed), ShouldEqual, 1)
+		So(len(SemanticDiff(table, other, nil)), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,206 @@
+package golpm
+
+import (
+	"net"
+	"reflect"
+	"sort"
+)
+
+// sourceIndex The contributions of the sources of a table
+type sourceIndex struct {
+	prefixes map[string]*sourcedPrefix
+	priority map[string]int
+}
+
+type sourcedPrefix struct {
+	prefix        *net.IPNet
+	contributions map[string]*contribution
+}
+
+type contribution struct {
+	entry interface{}
+	stale bool
+}
+
+func (rt *RadixTable) sourceIndex() *sourceIndex {
+	if rt.sources == nil {
+		rt.sources = &sourceIndex{
+			prefixes: make(map[string]*sourcedPrefix),
+			priority: make(map[string]int),
+		}
+	}
+	return rt.sources
+}
+
+// SetSourcePriority Set the priority of source, the entry of the source with
+// the lowest priority is installed when several contribute a prefix. Sources
+// default to priority 0, ties go to the lowest source name.
+func (rt *RadixTable) SetSourcePriority(source string, priority int) error {
+	si := rt.sourceIndex()
+	si.priority[source] = priority
+	for _, sp := range si.sortedPrefixes() {
+		if err := rt.install(sp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddFrom Add entry for prefix on behalf of source. Each source keeps its
+// own entry for the prefix; adding the entry a source already has does not
+// touch the table, and clears the stale mark of the entry.
+func (rt *RadixTable) AddFrom(source string, prefix string, entry interface{}) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return rt.AddIPNetFrom(source, ipNet, entry)
+}
+
+func (rt *RadixTable) AddIPNetFrom(source string, prefix *net.IPNet, entry interface{}) error {
+	if err := rt.checkFamily(prefix.IP, "add"); err != nil {
+		return err
+	}
+	si := rt.sourceIndex()
+	key := prefix.String()
+	sp := si.prefixes[key]
+	if sp == nil {
+		sp = &sourcedPrefix{prefix: prefix, contributions: make(map[string]*contribution)}
+		si.prefixes[key] = sp
+	}
+	sp.contributions[source] = &contribution{entry: entry}
+	return rt.install(sp)
+}
+
+// DeleteFrom Delete the entry of source for prefix, the entry of another
+// source taking over when there is one
+func (rt *RadixTable) DeleteFrom(source string, prefix string) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return rt.DeleteIPNetFrom(source, ipNet)
+}
+
+func (rt *RadixTable) DeleteIPNetFrom(source string, prefix *net.IPNet) error {
+	if err := rt.checkFamily(prefix.IP, "delete"); err != nil {
+		return err
+	}
+	sp := rt.sourceIndex().prefixes[prefix.String()]
+	if sp == nil || sp.contributions[source] == nil {
+		return nil
+	}
+	delete(sp.contributions, source)
+	return rt.install(sp)
+}
+
+// Sources Return the sources contributing prefix, in priority order
+func (rt *RadixTable) Sources(prefix string) []string {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil
+	}
+	sp := rt.sourceIndex().prefixes[ipNet.String()]
+	if sp == nil {
+		return nil
+	}
+	return rt.sources.ranked(sp)
+}
+
+// FlushSource Delete every entry of source, returning the number of prefixes
+// it contributed
+func (rt *RadixTable) FlushSource(source string) (int, error) {
+	return rt.deleteContributions(source, false)
+}
+
+// MarkStale Mark every entry of source as stale, typically when the source
+// restarts. Entries the source adds again are kept, Sweep removes the others.
+func (rt *RadixTable) MarkStale(source string) {
+	for _, sp := range rt.sourceIndex().prefixes {
+		if c := sp.contributions[source]; c != nil {
+			c.stale = true
+		}
+	}
+}
+
+// Sweep Delete the entries of source still marked stale, returning their
+// number
+func (rt *RadixTable) Sweep(source string) (int, error) {
+	return rt.deleteContributions(source, true)
+}
+
+func (rt *RadixTable) deleteContributions(source string, staleOnly bool) (int, error) {
+	count := 0
+	for _, sp := range rt.sourceIndex().sortedPrefixes() {
+		c := sp.contributions[source]
+		if c == nil || staleOnly && !c.stale {
+			continue
+		}
+		delete(sp.contributions, source)
+		if err := rt.install(sp); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// forget Drop the contributions of every source for prefix, deleted from
+// the table without going through the sources
+func (si *sourceIndex) forget(prefix *net.IPNet) {
+	delete(si.prefixes, prefix.String())
+}
+
+// install Put the entry of the preferred source of sp in the table, unless
+// it is already there
+func (rt *RadixTable) install(sp *sourcedPrefix) error {
+	ranked := rt.sources.ranked(sp)
+	current := rt.GetIPNet(sp.prefix)
+	if len(ranked) == 0 {
+		rt.sources.forget(sp.prefix)
+		if current != nil && current.Source != "" {
+			return rt.DeleteIPNet(sp.prefix)
+		}
+		return nil
+	}
+
+	source := ranked[0]
+	entry := sp.contributions[source].entry
+	if current != nil && current.Source == source && reflect.DeepEqual(current.Entry, entry) {
+		return nil
+	}
+	return rt.insert(&Entry{
+		Prefix: sp.prefix,
+		Entry:  entry,
+		Source: source,
+	})
+}
+
+// ranked Return the sources of sp, preferred first
+func (si *sourceIndex) ranked(sp *sourcedPrefix) []string {
+	sources := make([]string, 0, len(sp.contributions))
+	for source := range sp.contributions {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		pi, pj := si.priority[sources[i]], si.priority[sources[j]]
+		if pi != pj {
+			return pi < pj
+		}
+		return sources[i] < sources[j]
+	})
+	return sources
+}
+
+// sortedPrefixes Return the sourced prefixes in prefix order, so that
+// changes are applied deterministically
+func (si *sourceIndex) sortedPrefixes() []*sourcedPrefix {
+	prefixes := make([]*sourcedPrefix, 0, len(si.prefixes))
+	for _, sp := range si.prefixes {
+		prefixes = append(prefixes, sp)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return comparePrefix(prefixes[i].prefix, prefixes[j].prefix) < 0
+	})
+	return prefixes
+}
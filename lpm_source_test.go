@@ -0,0 +1,90 @@
+package golpm
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRadixTable_Sources(t *testing.T) {
+	Convey("Track the sources of each prefix", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		So(table.SetSourcePriority("static", -10), ShouldBeNil)
+		var changes []DiffEntry
+		table.Watch("0.0.0.0/0", func(change DiffEntry) {
+			changes = append(changes, change)
+		})
+
+		So(table.AddFrom("bgp", "10.0.0.0/8", "bgp-nh"), ShouldBeNil)
+		So(table.AddFrom("static", "10.0.0.0/8", "static-nh"), ShouldBeNil)
+		So(table.AddFrom("bgp", "10.1.0.0/16", "bgp-nh"), ShouldBeNil)
+		So(table.AddFrom("dhcp", "192.168.1.0/24", "lan"), ShouldBeNil)
+		So(table.AddFrom("bgp", "2001:db8::/32", "x"), ShouldBeError)
+
+		So(table.Lookup("10.2.0.1").Entry, ShouldEqual, "static-nh")
+		So(table.Lookup("10.2.0.1").Source, ShouldEqual, "static")
+		So(table.Sources("10.0.0.0/8"), ShouldResemble, []string{"static", "bgp"})
+		So(table.Sources("172.16.0.0/12"), ShouldBeNil)
+
+		Convey("Delete the entry of one source only", func() {
+			So(table.DeleteFrom("static", "10.0.0.0/8"), ShouldBeNil)
+			So(table.Lookup("10.2.0.1").Entry, ShouldEqual, "bgp-nh")
+			So(table.DeleteFrom("dhcp", "10.0.0.0/8"), ShouldBeNil)
+			So(table.Lookup("10.2.0.1").Entry, ShouldEqual, "bgp-nh")
+			So(table.DeleteFrom("bgp", "10.0.0.0/8"), ShouldBeNil)
+			So(table.Get("10.0.0.0/8"), ShouldBeNil)
+		})
+
+		Convey("Forget the sources of a prefix deleted directly", func() {
+			So(table.Delete("10.0.0.0/8"), ShouldBeNil)
+			So(table.Sources("10.0.0.0/8"), ShouldBeNil)
+			So(table.AddFrom("dhcp", "10.0.0.0/8", "dhcp-nh"), ShouldBeNil)
+			So(table.Sources("10.0.0.0/8"), ShouldResemble, []string{"dhcp"})
+			So(table.Lookup("10.2.0.1").Entry, ShouldEqual, "dhcp-nh")
+			So(table.DeleteFrom("dhcp", "10.0.0.0/8"), ShouldBeNil)
+			So(table.Lookup("10.2.0.1"), ShouldBeNil)
+		})
+
+		Convey("Flush a source", func() {
+			count, err := table.FlushSource("bgp")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+			So(table.Lookup("10.1.0.1").Entry, ShouldEqual, "static-nh")
+			So(table.Lookup("192.168.1.1").Entry, ShouldEqual, "lan")
+			count, err = table.FlushSource("bgp")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+
+		Convey("Restart a source gracefully", func() {
+			So(table.SetSourcePriority("static", 10), ShouldBeNil)
+			So(table.Lookup("10.2.0.1").Entry, ShouldEqual, "bgp-nh")
+
+			changes = nil
+			table.MarkStale("bgp")
+			So(table.AddFrom("bgp", "10.0.0.0/8", "bgp-nh"), ShouldBeNil)
+			So(changes, ShouldBeEmpty)
+
+			count, err := table.Sweep("bgp")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+			So(table.Get("10.1.0.0/16"), ShouldBeNil)
+			So(table.Lookup("10.2.0.1").Entry, ShouldEqual, "bgp-nh")
+			So(len(changes), ShouldEqual, 1)
+			So(changes[0].Op, ShouldEqual, DiffRemoved)
+			count, err = table.Sweep("bgp")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+
+		Convey("Leave entries added without source alone", func() {
+			So(table.Add("172.16.0.0/12", "plain"), ShouldBeNil)
+			_, err := table.FlushSource("bgp")
+			So(err, ShouldBeNil)
+			_, err = table.FlushSource("static")
+			So(err, ShouldBeNil)
+			So(table.Lookup("172.16.0.1").Entry, ShouldEqual, "plain")
+			So(table.Lookup("172.16.0.1").Source, ShouldEqual, "")
+		})
+	})
+}
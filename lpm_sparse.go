@@ -0,0 +1,133 @@
+package golpm
+
+import (
+	mathbits "math/bits"
+)
+
+// A node stores its children sparse while few: a bitmap of the child
+// indexes present, with the children packed in index order, and dense in
+// a slot per index once more than 1/sparseMaxRatio of the slots are used.
+// It goes back to sparse below 1/sparseMinRatio, so that a node alternating
+// around the threshold does not convert on every change.
+const (
+	sparseMaxRatio = 4
+	sparseMinRatio = 8
+)
+
+// sparseWord 64 bits of the bitmap of a sparse node, with the number of
+// children of the words before it
+type sparseWord struct {
+	bits uint64
+	rank uint32
+}
+
+// dense Report whether the children are stored a slot per index
+func (rt *radixNode) dense() bool {
+	return rt.sparse == nil && rt.children != nil
+}
+
+// child Return the child at idx, nil when missing
+func (rt *radixNode) child(idx int) *radixNode {
+	if rt.sparse == nil {
+		if rt.children == nil {
+			return nil
+		}
+		return rt.children[idx]
+	}
+	word := rt.sparse[idx>>6]
+	bit := uint64(1) << (idx & 63)
+	if word.bits&bit == 0 {
+		return nil
+	}
+	return rt.children[int(word.rank)+mathbits.OnesCount64(word.bits&(bit-1))]
+}
+
+// setChild Set the child at idx, removing it when child is nil, and keep
+// childCnt and the storage of the children up to date
+func (rt *radixNode) setChild(idx int, child *radixNode) {
+	slots := 1 << rt.width
+	if rt.dense() {
+		if old := rt.children[idx]; old == nil && child != nil {
+			rt.childCnt++
+		} else if old != nil && child == nil {
+			rt.childCnt--
+		}
+		rt.children[idx] = child
+		if rt.childCnt == 0 {
+			rt.children = nil
+		} else if rt.childCnt*sparseMinRatio < slots {
+			rt.makeSparse()
+		}
+		return
+	}
+
+	if rt.sparse == nil {
+		if child == nil {
+			return
+		}
+		rt.sparse = make([]sparseWord, (slots+63)/64)
+	}
+	w, bit := idx>>6, uint64(1)<<(idx&63)
+	pos := int(rt.sparse[w].rank) + mathbits.OnesCount64(rt.sparse[w].bits&(bit-1))
+	present := rt.sparse[w].bits&bit != 0
+	switch {
+	case present && child != nil:
+		rt.children[pos] = child
+		return
+	case present:
+		last := len(rt.children) - 1
+		copy(rt.children[pos:], rt.children[pos+1:])
+		// clear the freed slot, so that the spare capacity holds no stale child
+		rt.children[last] = nil
+		rt.children = rt.children[:last]
+		rt.sparse[w].bits &^= bit
+		for i := w + 1; i < len(rt.sparse); i++ {
+			rt.sparse[i].rank--
+		}
+		rt.childCnt--
+	case child != nil:
+		rt.children = append(rt.children, nil)
+		copy(rt.children[pos+1:], rt.children[pos:])
+		rt.children[pos] = child
+		rt.sparse[w].bits |= bit
+		for i := w + 1; i < len(rt.sparse); i++ {
+			rt.sparse[i].rank++
+		}
+		rt.childCnt++
+	default:
+		return
+	}
+
+	if rt.childCnt == 0 {
+		rt.sparse, rt.children = nil, nil
+	} else if rt.childCnt*sparseMaxRatio > slots {
+		rt.makeDense()
+	}
+}
+
+func (rt *radixNode) makeDense() {
+	children := make([]*radixNode, 1<<rt.width)
+	pos := 0
+	for w, word := range rt.sparse {
+		for bits := word.bits; bits != 0; bits &= bits - 1 {
+			children[w<<6+mathbits.TrailingZeros64(bits)] = rt.children[pos]
+			pos++
+		}
+	}
+	rt.sparse, rt.children = nil, children
+}
+
+func (rt *radixNode) makeSparse() {
+	sparse := make([]sparseWord, (len(rt.children)+63)/64)
+	children := make([]*radixNode, 0, rt.childCnt)
+	for idx, child := range rt.children {
+		if child != nil {
+			sparse[idx>>6].bits |= 1 << (idx & 63)
+			children = append(children, child)
+		}
+	}
+	for i := 1; i < len(sparse); i++ {
+		sparse[i].rank = sparse[i-1].rank + uint32(mathbits.OnesCount64(sparse[i-1].bits))
+	}
+	rt.sparse, rt.children = sparse, children
+}
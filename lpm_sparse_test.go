@@ -0,0 +1,113 @@
+package golpm
+
+import (
+	"math/rand"
+	"net"
+	"runtime"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRadixNode_SparseChildren(t *testing.T) {
+	Convey("Store few children sparse", t, func() {
+		node := &radixNode{width: 8}
+		So(node.child(7), ShouldBeNil)
+		node.setChild(7, &radixNode{})
+		node.setChild(200, &radixNode{})
+		So(node.dense(), ShouldBeFalse)
+		So(len(node.children), ShouldEqual, 2)
+		So(node.childCnt, ShouldEqual, 2)
+		So(node.child(7), ShouldEqual, node.children[0])
+		So(node.child(200), ShouldEqual, node.children[1])
+		So(node.child(8), ShouldBeNil)
+
+		node.setChild(7, nil)
+		So(node.child(200), ShouldEqual, node.children[0])
+		So(node.children[:2][1], ShouldBeNil)
+		node.setChild(200, nil)
+		So(node.childCnt, ShouldEqual, 0)
+		So(node.sparse, ShouldBeNil)
+		So(node.children, ShouldBeNil)
+	})
+
+	Convey("Switch between sparse and dense storage", t, func() {
+		node := &radixNode{width: 8}
+		for idx := 0; idx <= 256/sparseMaxRatio; idx++ {
+			So(node.dense(), ShouldBeFalse)
+			node.setChild(idx, &radixNode{})
+		}
+		So(node.dense(), ShouldBeTrue)
+		So(len(node.children), ShouldEqual, 256)
+
+		for idx := 256 / sparseMaxRatio; idx >= 256/sparseMinRatio-1; idx-- {
+			So(node.dense(), ShouldBeTrue)
+			node.setChild(idx, nil)
+		}
+		So(node.dense(), ShouldBeFalse)
+		So(node.childCnt, ShouldEqual, 256/sparseMinRatio-1)
+		So(len(node.children), ShouldEqual, node.childCnt)
+	})
+
+	Convey("Keep children like a map", t, func() {
+		rnd := rand.New(rand.NewSource(7))
+		for _, width := range []int{4, 8, 12} {
+			node := &radixNode{width: width}
+			children := make(map[int]*radixNode)
+			for round := 0; round < 20000; round++ {
+				idx := rnd.Intn(1 << width)
+				if rnd.Intn(3) == 0 {
+					delete(children, idx)
+					node.setChild(idx, nil)
+				} else {
+					child := &radixNode{}
+					children[idx] = child
+					node.setChild(idx, child)
+				}
+				So(node.childCnt, ShouldEqual, len(children))
+				if round%100 == 0 {
+					for idx := 0; idx < 1<<width; idx++ {
+						So(node.child(idx), ShouldEqual, children[idx])
+					}
+				}
+			}
+		}
+	})
+}
+
+func benchmarkMemory(b *testing.B, isIPv6 bool) {
+	rnd := rand.New(rand.NewSource(11))
+	bits := 32
+	if isIPv6 {
+		bits = 128
+	}
+	prefixes := make([]*net.IPNet, 100000)
+	for i := range prefixes {
+		ip := make(net.IP, bits/8)
+		rnd.Read(ip)
+		maskLen := 8 + rnd.Intn(bits-7)
+		prefixes[i] = &net.IPNet{IP: ip.Mask(net.CIDRMask(maskLen, bits)), Mask: net.CIDRMask(maskLen, bits)}
+	}
+
+	var before, after runtime.MemStats
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		table := NewRadixLPMTable(isIPv6)
+		for _, prefix := range prefixes {
+			table.AddIPNet(prefix, nil)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/float64(len(prefixes)), "heap-B/prefix")
+		runtime.KeepAlive(table)
+	}
+}
+
+func BenchmarkRadixTable_Memory_ipv4(b *testing.B) {
+	benchmarkMemory(b, false)
+}
+
+func BenchmarkRadixTable_Memory_ipv6(b *testing.B) {
+	benchmarkMemory(b, true)
+}
@@ -0,0 +1,134 @@
+package golpm
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// SpecialRegistryVersion The revision of the embedded special-purpose registries.
+// It changes whenever the registry data shipped with the package is updated.
+const SpecialRegistryVersion = "2024-07"
+
+// SpecialCategory The kind of a special-purpose address block
+type SpecialCategory string
+
+const (
+	SpecialThisNetwork   SpecialCategory = "this-network"
+	SpecialUnspecified   SpecialCategory = "unspecified"
+	SpecialPrivate       SpecialCategory = "private"
+	SpecialCGNAT         SpecialCategory = "cgnat"
+	SpecialLoopback      SpecialCategory = "loopback"
+	SpecialLinkLocal     SpecialCategory = "link-local"
+	SpecialProtocol      SpecialCategory = "protocol"
+	SpecialDocumentation SpecialCategory = "documentation"
+	SpecialBenchmarking  SpecialCategory = "benchmarking"
+	SpecialTranslation   SpecialCategory = "translation"
+	SpecialMulticast     SpecialCategory = "multicast"
+	SpecialBroadcast     SpecialCategory = "broadcast"
+	SpecialReserved      SpecialCategory = "reserved"
+)
+
+//go:embed registry/special-ipv4.csv
+var specialIPv4CSV string
+
+//go:embed registry/special-ipv6.csv
+var specialIPv6CSV string
+
+// SpecialBlock A block of the IANA special-purpose address registries.
+// Attributes listed as N/A by IANA are false.
+type SpecialBlock struct {
+	Prefix             *net.IPNet
+	Name               string
+	RFC                string
+	Allocated          string
+	Category           SpecialCategory
+	Source             bool
+	Destination        bool
+	Forwardable        bool
+	GloballyReachable  bool
+	ReservedByProtocol bool
+}
+
+var specialTables struct {
+	once sync.Once
+	v4   LPMTable
+	v6   LPMTable
+}
+
+func parseSpecialRegistry(data string, isIPv6 bool) (LPMTable, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 10
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	table := NewRadixLPMTable(isIPv6)
+	for _, record := range records {
+		_, prefix, err := net.ParseCIDR(record[0])
+		if err != nil {
+			return nil, err
+		}
+		block := &SpecialBlock{
+			Prefix:             prefix,
+			Name:               record[1],
+			RFC:                record[2],
+			Allocated:          record[3],
+			Category:           SpecialCategory(record[4]),
+			Source:             record[5] == "True",
+			Destination:        record[6] == "True",
+			Forwardable:        record[7] == "True",
+			GloballyReachable:  record[8] == "True",
+			ReservedByProtocol: record[9] == "True",
+		}
+		if err = table.AddIPNet(prefix, block); err != nil {
+			return nil, fmt.Errorf("special-purpose block %s: %w", record[0], err)
+		}
+	}
+	return table, nil
+}
+
+// SpecialPurposeV4 Return a new ipv4 table of the special-purpose blocks,
+// entries are *SpecialBlock
+func SpecialPurposeV4() LPMTable {
+	table, err := parseSpecialRegistry(specialIPv4CSV, false)
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
+
+// SpecialPurposeV6 Return a new ipv6 table of the special-purpose blocks,
+// entries are *SpecialBlock
+func SpecialPurposeV6() LPMTable {
+	table, err := parseSpecialRegistry(specialIPv6CSV, true)
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
+
+// Classify Return the most specific special-purpose block containing ip,
+// or nil for an ordinary address. IPv4-mapped addresses are classified as
+// the ipv4 address they carry.
+func Classify(ip net.IP) *SpecialBlock {
+	specialTables.once.Do(func() {
+		specialTables.v4 = SpecialPurposeV4()
+		specialTables.v6 = SpecialPurposeV6()
+	})
+
+	table := specialTables.v6
+	if ip.To4() != nil {
+		table = specialTables.v4
+	}
+	entry := table.LookupIP(ip)
+	if entry == nil {
+		return nil
+	}
+	return entry.Entry.(*SpecialBlock)
+}
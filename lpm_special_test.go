@@ -0,0 +1,62 @@
+package golpm
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSpecialPurpose(t *testing.T) {
+	Convey("Build the special-purpose tables", t, func() {
+		v4 := SpecialPurposeV4()
+		So(len(v4.Show()[8]), ShouldEqual, 3)
+		So(v4.(PrefixGetter).Get("100.64.0.0/10").Entry.(*SpecialBlock).Category, ShouldEqual, SpecialCGNAT)
+
+		v6 := SpecialPurposeV6()
+		So(v6.(PrefixGetter).Get("2001:db8::/32").Entry.(*SpecialBlock).Category, ShouldEqual, SpecialDocumentation)
+
+		// tables are independent copies
+		v4.Delete("10.0.0.0/8")
+		So(SpecialPurposeV4().(PrefixGetter).Get("10.0.0.0/8"), ShouldNotBeNil)
+	})
+
+	Convey("Classify ipv4 addresses", t, func() {
+		block := Classify(net.ParseIP("10.1.2.3"))
+		So(block.Category, ShouldEqual, SpecialPrivate)
+		So(block.Forwardable, ShouldBeTrue)
+		So(block.GloballyReachable, ShouldBeFalse)
+
+		block = Classify(net.ParseIP("0.0.0.0"))
+		So(block.Name, ShouldEqual, "This host on this network")
+		block = Classify(net.ParseIP("0.1.2.3"))
+		So(block.Name, ShouldEqual, "This network")
+
+		block = Classify(net.ParseIP("192.0.0.9"))
+		So(block.GloballyReachable, ShouldBeTrue)
+		So(Classify(net.ParseIP("192.0.0.100")).Name, ShouldEqual, "IETF Protocol Assignments")
+
+		So(Classify(net.ParseIP("127.0.0.1")).Category, ShouldEqual, SpecialLoopback)
+		So(Classify(net.ParseIP("100.100.1.1")).Category, ShouldEqual, SpecialCGNAT)
+		So(Classify(net.ParseIP("203.0.113.5")).Category, ShouldEqual, SpecialDocumentation)
+		So(Classify(net.ParseIP("239.1.1.1")).Category, ShouldEqual, SpecialMulticast)
+		So(Classify(net.ParseIP("250.1.1.1")).Category, ShouldEqual, SpecialReserved)
+		So(Classify(net.ParseIP("255.255.255.255")).Category, ShouldEqual, SpecialBroadcast)
+		So(Classify(net.ParseIP("::ffff:192.168.1.1")).Category, ShouldEqual, SpecialPrivate)
+		So(Classify(net.ParseIP("8.8.8.8")), ShouldBeNil)
+	})
+
+	Convey("Classify ipv6 addresses", t, func() {
+		So(Classify(net.ParseIP("::")).Category, ShouldEqual, SpecialUnspecified)
+		So(Classify(net.ParseIP("::1")).Category, ShouldEqual, SpecialLoopback)
+		So(Classify(net.ParseIP("fd00::1")).Category, ShouldEqual, SpecialPrivate)
+		So(Classify(net.ParseIP("fe80::1")).Category, ShouldEqual, SpecialLinkLocal)
+		So(Classify(net.ParseIP("ff02::1")).Category, ShouldEqual, SpecialMulticast)
+		So(Classify(net.ParseIP("64:ff9b::1.2.3.4")).Category, ShouldEqual, SpecialTranslation)
+		So(Classify(net.ParseIP("2001::1")).Name, ShouldEqual, "TEREDO")
+		So(Classify(net.ParseIP("2001:1::1")).Name, ShouldEqual, "Port Control Protocol Anycast")
+		So(Classify(net.ParseIP("2001:1::5")).Name, ShouldEqual, "IETF Protocol Assignments")
+		So(Classify(net.ParseIP("3fff:1::1")).Category, ShouldEqual, SpecialDocumentation)
+		So(Classify(net.ParseIP("2606:4700::1111")), ShouldBeNil)
+	})
+}
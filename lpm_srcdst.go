@@ -0,0 +1,125 @@
+package golpm
+
+import (
+	"net"
+)
+
+// SrcDstTable A two-dimensional lpm table keyed on destination and source
+// prefixes, for source-specific routing. It is a destination radix table
+// whose entries are source radix tables.
+type SrcDstTable struct {
+	dst    *RadixTable
+	isIPv6 bool
+}
+
+// NewSrcDstTable Create an empty source and destination table
+func NewSrcDstTable(isIPv6 bool) *SrcDstTable {
+	return &SrcDstTable{
+		dst:    NewRadixLPMTable(isIPv6).(*RadixTable),
+		isIPv6: isIPv6,
+	}
+}
+
+func (sd *SrcDstTable) Add(dst, src string, entry interface{}) error {
+	_, dstNet, err := net.ParseCIDR(dst)
+	if err != nil {
+		return err
+	}
+	_, srcNet, err := net.ParseCIDR(src)
+	if err != nil {
+		return err
+	}
+	return sd.AddIPNet(dstNet, srcNet, entry)
+}
+
+// AddIPNet Add entry for packets to dst from src, ::/0 or 0.0.0.0/0 as
+// src matching any source
+func (sd *SrcDstTable) AddIPNet(dst, src *net.IPNet, entry interface{}) error {
+	if e := sd.dst.GetIPNet(dst); e != nil {
+		return e.Entry.(*RadixTable).AddIPNet(src, entry)
+	}
+	sources := NewRadixLPMTable(sd.isIPv6).(*RadixTable)
+	if err := sources.AddIPNet(src, entry); err != nil {
+		return err
+	}
+	return sd.dst.AddIPNet(dst, sources)
+}
+
+func (sd *SrcDstTable) Delete(dst, src string) error {
+	_, dstNet, err := net.ParseCIDR(dst)
+	if err != nil {
+		return err
+	}
+	_, srcNet, err := net.ParseCIDR(src)
+	if err != nil {
+		return err
+	}
+	return sd.DeleteIPNet(dstNet, srcNet)
+}
+
+func (sd *SrcDstTable) DeleteIPNet(dst, src *net.IPNet) error {
+	e := sd.dst.GetIPNet(dst)
+	if e == nil {
+		return nil
+	}
+	sources := e.Entry.(*RadixTable)
+	if err := sources.DeleteIPNet(src); err != nil {
+		return err
+	}
+	if sources.root.childCnt == 0 && sources.defaultEntry == nil {
+		return sd.dst.DeleteIPNet(dst)
+	}
+	return nil
+}
+
+// Get Return the entry of exactly dst and src
+func (sd *SrcDstTable) Get(dst, src string) *Entry {
+	_, dstNet, err := net.ParseCIDR(dst)
+	if err != nil {
+		return nil
+	}
+	_, srcNet, err := net.ParseCIDR(src)
+	if err != nil {
+		return nil
+	}
+	e := sd.dst.GetIPNet(dstNet)
+	if e == nil {
+		return nil
+	}
+	return e.Entry.(*RadixTable).GetIPNet(srcNet)
+}
+
+func (sd *SrcDstTable) Lookup(dstIP, srcIP string) *Entry {
+	dst, src := net.ParseIP(dstIP), net.ParseIP(srcIP)
+	if dst == nil || src == nil {
+		return nil
+	}
+	return sd.LookupIP(dst, src)
+}
+
+// LookupIP Return the entry of the longest source prefix matching src
+// within the longest destination prefix matching dst. When no source of a
+// destination prefix matches, shorter destination prefixes are tried, as
+// described in RFC 8678.
+func (sd *SrcDstTable) LookupIP(dst, src net.IP) *Entry {
+	e := sd.dst.lookup(dst, func(e *Entry) bool {
+		return e.Entry.(*RadixTable).LookupIP(src) != nil
+	})
+	if e == nil {
+		return nil
+	}
+	return e.Entry.(*RadixTable).LookupIP(src)
+}
+
+// Walk Call fn for each entry in destination then source prefix order,
+// until fn returns false
+func (sd *SrcDstTable) Walk(fn func(dst *net.IPNet, entry *Entry) bool) {
+	more := true
+	sd.dst.Walk(func(e *Entry) bool {
+		e.Entry.(*RadixTable).Walk(func(entry *Entry) bool {
+			more = fn(e.Prefix, entry)
+			return more
+		})
+		return more
+	})
+}
@@ -0,0 +1,52 @@
+package golpm
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSrcDstTable(t *testing.T) {
+	Convey("Look up destination then source", t, func() {
+		table := NewSrcDstTable(true)
+		// two uplinks, each only accepting its own source prefix
+		So(table.Add("::/0", "2001:db8:a::/48", "isp-a"), ShouldBeNil)
+		So(table.Add("::/0", "2001:db8:b::/48", "isp-b"), ShouldBeNil)
+		So(table.Add("2001:db8:c::/48", "::/0", "internal"), ShouldBeNil)
+		So(table.Add("2001:db8:d::/48", "2001:db8:a::/48", "partner-a"), ShouldBeNil)
+		So(table.Add("2001:db8:d::/48", "2001:db8:a:1::/64", "partner-a1"), ShouldBeNil)
+		So(table.Add("10.0.0.0/8", "::/0", "x"), ShouldBeError)
+
+		So(table.Lookup("2001:db8:ffff::1", "2001:db8:a::5").Entry, ShouldEqual, "isp-a")
+		So(table.Lookup("2001:db8:ffff::1", "2001:db8:b::5").Entry, ShouldEqual, "isp-b")
+		So(table.Lookup("2001:db8:ffff::1", "2001:db8:e::5"), ShouldBeNil)
+		So(table.Lookup("2001:db8:c::1", "2001:db8:b::5").Entry, ShouldEqual, "internal")
+		So(table.Lookup("2001:db8:d::1", "2001:db8:a::5").Entry, ShouldEqual, "partner-a")
+		So(table.Lookup("2001:db8:d::1", "2001:db8:a:1::5").Entry, ShouldEqual, "partner-a1")
+		// no source matches the longest destination, a shorter one is used
+		So(table.Lookup("2001:db8:d::1", "2001:db8:b::5").Entry, ShouldEqual, "isp-b")
+		So(table.Lookup("bad", "2001:db8:b::5"), ShouldBeNil)
+
+		So(table.Get("2001:db8:d::/48", "2001:db8:a::/48").Entry, ShouldEqual, "partner-a")
+		So(table.Get("2001:db8:d::/48", "::/0"), ShouldBeNil)
+
+		var entries []string
+		table.Walk(func(dst *net.IPNet, entry *Entry) bool {
+			entries = append(entries, fmt.Sprint(dst, " ", entry.Prefix))
+			return len(entries) < 4
+		})
+		So(entries, ShouldResemble, []string{
+			"::/0 2001:db8:a::/48", "::/0 2001:db8:b::/48", "2001:db8:c::/48 ::/0", "2001:db8:d::/48 2001:db8:a::/48",
+		})
+
+		Convey("Delete entries", func() {
+			So(table.Delete("2001:db8:d::/48", "2001:db8:a::/48"), ShouldBeNil)
+			So(table.Lookup("2001:db8:d::1", "2001:db8:a::5").Entry, ShouldEqual, "isp-a")
+			So(table.Delete("2001:db8:d::/48", "2001:db8:a:1::/64"), ShouldBeNil)
+			So(table.dst.Get("2001:db8:d::/48"), ShouldBeNil)
+			So(table.Delete("2001:db8:9::/48", "::/0"), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,329 @@
+package golpm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+)
+
+// Rule A table selection rule, after the Linux policy routing rules. A rule
+// matches packets whose source is in From and destination in To, a nil
+// selector matching any address.
+type Rule struct {
+	Priority int
+	From     *net.IPNet
+	To       *net.IPNet
+	Table    string
+}
+
+func (r *Rule) matches(src, dst net.IP) bool {
+	return (r.From == nil || src != nil && r.From.Contains(src)) &&
+		(r.To == nil || r.To.Contains(dst))
+}
+
+// TableStats The number of prefixes of a table of a set
+type TableStats struct {
+	Name string
+	V4   int
+	V6   int
+}
+
+// TableSetStats The number of prefixes of every table of a set and their totals
+type TableSetStats struct {
+	Tables []TableStats // by name
+	V4     int
+	V6     int
+	Rules  int
+}
+
+// TableSet A set of dual-family tables keyed by name, such as the tables
+// of VRFs, with rules selecting the tables consulted for a packet.
+type TableSet struct {
+	arch   string
+	tables map[string]*DualTable
+	rules  []Rule // by priority
+}
+
+// NewTableSet Create an empty table set, tables being created with arch
+func NewTableSet(arch string) *TableSet {
+	return &TableSet{
+		arch:   arch,
+		tables: make(map[string]*DualTable),
+	}
+}
+
+// Table Return the table of name, creating it when needed
+func (ts *TableSet) Table(name string) *DualTable {
+	table := ts.tables[name]
+	if table == nil {
+		table = NewDualLPMTable(ts.arch)
+		ts.tables[name] = table
+	}
+	return table
+}
+
+// Get Return the table of name, or nil when there is none
+func (ts *TableSet) Get(name string) *DualTable {
+	return ts.tables[name]
+}
+
+// Remove Remove the table of name, reporting whether it existed. Rules
+// using it are kept and skip it.
+func (ts *TableSet) Remove(name string) bool {
+	_, ok := ts.tables[name]
+	delete(ts.tables, name)
+	return ok
+}
+
+// Names Return the names of the tables in order
+func (ts *TableSet) Names() []string {
+	names := make([]string, 0, len(ts.tables))
+	for name := range ts.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AddRule Add a rule, after the existing rules of the same priority
+func (ts *TableSet) AddRule(rule Rule) {
+	i := sort.Search(len(ts.rules), func(i int) bool {
+		return ts.rules[i].Priority > rule.Priority
+	})
+	ts.rules = append(ts.rules, Rule{})
+	copy(ts.rules[i+1:], ts.rules[i:])
+	ts.rules[i] = rule
+}
+
+// DeleteRules Delete the rules of priority, returning their number
+func (ts *TableSet) DeleteRules(priority int) int {
+	rules := ts.rules[:0]
+	for _, rule := range ts.rules {
+		if rule.Priority != priority {
+			rules = append(rules, rule)
+		}
+	}
+	count := len(ts.rules) - len(rules)
+	ts.rules = rules
+	return count
+}
+
+// Rules Return the rules in priority order
+func (ts *TableSet) Rules() []Rule {
+	return append([]Rule(nil), ts.rules...)
+}
+
+// Route Look dst up in the tables of the rules matching src and dst, in
+// priority order. A table without route for dst, or with a throw route,
+// passes on to the next rule; any other route ends the lookup. src may be
+// nil to match only rules without source selector.
+func (ts *TableSet) Route(src, dst net.IP) (string, LookupResult) {
+	for i := range ts.rules {
+		rule := &ts.rules[i]
+		table := ts.tables[rule.Table]
+		if table == nil || !rule.matches(src, dst) {
+			continue
+		}
+		if result := table.LookupRouteIP(dst); result.Found {
+			return rule.Table, result
+		}
+	}
+	return "", LookupResult{}
+}
+
+// Leak Copy the entries of table from covered by prefix to table to,
+// creating it when needed, and return their number
+func (ts *TableSet) Leak(from, to string, prefix *net.IPNet) (int, error) {
+	src := ts.tables[from]
+	if src == nil {
+		return 0, fmt.Errorf("no table %q", from)
+	}
+	dst := ts.Table(to)
+
+	var leaked []*Entry
+	cursor := tableCursor(src)
+	for entry := cursor.next(); entry != nil; entry = cursor.next() {
+		if prefixCovers(prefix, entry.Prefix) {
+			leaked = append(leaked, entry)
+		}
+	}
+	for _, entry := range leaked {
+		if err := addEntry(dst, entry); err != nil {
+			return 0, err
+		}
+	}
+	return len(leaked), nil
+}
+
+// prefixCovers Report whether inner is outer or one of its sub-prefixes
+func prefixCovers(outer, inner *net.IPNet) bool {
+	outerSize, outerBits := outer.Mask.Size()
+	innerSize, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && innerSize >= outerSize && outer.Contains(inner.IP)
+}
+
+// addEntry Add a copy of entry to table, keeping its route type and
+// exclusions, failing when the table does not support them
+func addEntry(table LPMTable, entry *Entry) error {
+	copied := &Entry{
+		Prefix: entry.Prefix,
+		Entry:  entry.Entry,
+		Except: entry.Except,
+		Type:   entry.Type,
+	}
+	switch t := table.(type) {
+	case *RadixTable:
+		return t.insert(copied)
+	case *ArenaTable:
+		return t.insert(copied)
+	case *DualTable:
+		return addEntry(t.tableFor(entry.Prefix.IP), entry)
+	}
+	if len(entry.Except) != 0 {
+		if entry.Type != RouteUnicast {
+			return fmt.Errorf("%T does not support %s routes with exclusions", table, entry.Type)
+		}
+		return addIPNetExcept(table, entry.Prefix, entry.Except, entry.Entry)
+	}
+	return addIPNetTyped(table, entry.Prefix, entry.Type, entry.Entry)
+}
+
+// Stats Return the number of prefixes of the tables
+func (ts *TableSet) Stats() TableSetStats {
+	stats := TableSetStats{Rules: len(ts.rules)}
+	for _, name := range ts.Names() {
+		table := ts.tables[name]
+		tableStats := TableStats{
+			Name: name,
+			V4:   tableLen(table.V4),
+			V6:   tableLen(table.V6),
+		}
+		stats.Tables = append(stats.Tables, tableStats)
+		stats.V4 += tableStats.V4
+		stats.V6 += tableStats.V6
+	}
+	return stats
+}
+
+// tableLen Return the number of entries of table, without building its
+// Show map for the tables of this package
+func tableLen(table LPMTable) int {
+	switch t := table.(type) {
+	case *ArenaTable:
+		return t.Len()
+	case *RadixTable:
+		size := 0
+		t.Walk(func(*Entry) bool {
+			size++
+			return true
+		})
+		return size
+	case *DualTable:
+		return tableLen(t.V4) + tableLen(t.V6)
+	}
+	size := 0
+	for _, entries := range table.Show() {
+		size += len(entries)
+	}
+	return size
+}
+
+type tableSetJSON struct {
+	Tables map[string][]entryJSON `json:"tables"`
+	Rules  []ruleJSON             `json:"rules,omitempty"`
+}
+
+type entryJSON struct {
+	Prefix string      `json:"prefix"`
+	Entry  interface{} `json:"entry"`
+	Type   RouteType   `json:"type,omitempty"`
+	Except []string    `json:"except,omitempty"`
+}
+
+type ruleJSON struct {
+	Priority int    `json:"priority"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+	Table    string `json:"table"`
+}
+
+// Save Write the tables and rules as JSON. Entries must be JSON values;
+// route types and exclusions are kept.
+func (ts *TableSet) Save(w io.Writer) error {
+	doc := tableSetJSON{Tables: make(map[string][]entryJSON)}
+	for name, table := range ts.tables {
+		entries := []entryJSON{}
+		cursor := tableCursor(table)
+		for entry := cursor.next(); entry != nil; entry = cursor.next() {
+			e := entryJSON{
+				Prefix: entry.Prefix.String(),
+				Entry:  entry.Entry,
+				Type:   entry.Type,
+			}
+			for _, exceptNet := range entry.Except {
+				e.Except = append(e.Except, exceptNet.String())
+			}
+			entries = append(entries, e)
+		}
+		doc.Tables[name] = entries
+	}
+	for _, rule := range ts.rules {
+		r := ruleJSON{Priority: rule.Priority, Table: rule.Table}
+		if rule.From != nil {
+			r.From = rule.From.String()
+		}
+		if rule.To != nil {
+			r.To = rule.To.String()
+		}
+		doc.Rules = append(doc.Rules, r)
+	}
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// LoadTableSet Read a table set written by Save. Entries are decoded as
+// by encoding/json into an interface{}.
+func LoadTableSet(r io.Reader, arch string) (*TableSet, error) {
+	var doc tableSetJSON
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	ts := NewTableSet(arch)
+	for name, entries := range doc.Tables {
+		table := ts.Table(name)
+		for _, e := range entries {
+			_, prefix, excepts, err := parseExcept(e.Prefix, e.Except)
+			if err != nil {
+				return nil, fmt.Errorf("table %q: %w", name, err)
+			}
+			if err = checkExcept(prefix, excepts); err != nil {
+				return nil, fmt.Errorf("table %q: %w", name, err)
+			}
+			if len(excepts) == 0 {
+				excepts = nil
+			}
+			entry := &Entry{Prefix: prefix, Entry: e.Entry, Type: e.Type, Except: excepts}
+			if err = addEntry(table, entry); err != nil {
+				return nil, fmt.Errorf("table %q: %w", name, err)
+			}
+		}
+	}
+	for _, r := range doc.Rules {
+		rule := Rule{Priority: r.Priority, Table: r.Table}
+		var err error
+		if r.From != "" {
+			if _, rule.From, err = net.ParseCIDR(r.From); err != nil {
+				return nil, err
+			}
+		}
+		if r.To != "" {
+			if _, rule.To, err = net.ParseCIDR(r.To); err != nil {
+				return nil, err
+			}
+		}
+		ts.AddRule(rule)
+	}
+	return ts, nil
+}
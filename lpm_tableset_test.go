@@ -0,0 +1,130 @@
+package golpm
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func mustCIDR(s string) *net.IPNet {
+	_, prefix, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return prefix
+}
+
+func TestTableSet(t *testing.T) {
+	Convey("Select tables with rules", t, func() {
+		ts := NewTableSet(ArchRadix)
+		ts.Table("main").Add("0.0.0.0/0", "isp")
+		ts.Table("main").Add("10.0.0.0/8", "core")
+		ts.Table("main").Add("2001:db8::/32", "v6")
+		ts.Table("guest").Add("0.0.0.0/0", "guest-uplink")
+		ts.Table("guest").AddTyped("10.0.0.0/8", RouteProhibit, nil)
+		ts.Table("vpn").Add("172.16.0.0/12", "tunnel")
+		ts.Table("vpn").AddTyped("172.16.99.0/24", RouteThrow, nil)
+
+		ts.AddRule(Rule{Priority: 32766, Table: "main"})
+		ts.AddRule(Rule{Priority: 100, From: mustCIDR("192.168.50.0/24"), Table: "guest"})
+		ts.AddRule(Rule{Priority: 50, To: mustCIDR("172.16.0.0/12"), Table: "vpn"})
+		ts.AddRule(Rule{Priority: 60, Table: "missing"})
+		So(len(ts.Rules()), ShouldEqual, 4)
+		So(ts.Rules()[0].Table, ShouldEqual, "vpn")
+
+		name, result := ts.Route(net.ParseIP("192.168.1.5"), net.ParseIP("10.1.1.1"))
+		So(name, ShouldEqual, "main")
+		So(result.Entry.Entry, ShouldEqual, "core")
+
+		name, result = ts.Route(net.ParseIP("192.168.50.5"), net.ParseIP("10.1.1.1"))
+		So(name, ShouldEqual, "guest")
+		So(result.Type, ShouldEqual, RouteProhibit)
+
+		name, result = ts.Route(net.ParseIP("192.168.50.5"), net.ParseIP("172.16.1.1"))
+		So(name, ShouldEqual, "vpn")
+		So(result.Entry.Entry, ShouldEqual, "tunnel")
+
+		// a throw route passes on to the next rules
+		name, result = ts.Route(nil, net.ParseIP("172.16.99.1"))
+		So(name, ShouldEqual, "main")
+		So(result.Entry.Entry, ShouldEqual, "isp")
+
+		name, result = ts.Route(nil, net.ParseIP("2001:db9::1"))
+		So(name, ShouldEqual, "")
+		So(result.Found, ShouldBeFalse)
+
+		So(ts.DeleteRules(50), ShouldEqual, 1)
+		name, _ = ts.Route(nil, net.ParseIP("172.16.1.1"))
+		So(name, ShouldEqual, "main")
+
+		Convey("Leak prefixes between tables", func() {
+			n, err := ts.Leak("main", "guest", mustCIDR("10.0.0.0/8"))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			name, result := ts.Route(net.ParseIP("192.168.50.5"), net.ParseIP("10.1.1.1"))
+			So(name, ShouldEqual, "guest")
+			So(result.Entry.Entry, ShouldEqual, "core")
+
+			n, err = ts.Leak("vpn", "lab", mustCIDR("172.16.0.0/16"))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(ts.Get("lab").Lookup("172.16.99.1").Type, ShouldEqual, RouteThrow)
+
+			_, err = ts.Leak("nope", "lab", mustCIDR("0.0.0.0/0"))
+			So(err, ShouldBeError)
+		})
+
+		Convey("Count the prefixes of the set", func() {
+			stats := ts.Stats()
+			So(stats.V4, ShouldEqual, 6)
+			So(stats.V6, ShouldEqual, 1)
+			So(stats.Rules, ShouldEqual, 3)
+			So(stats.Tables, ShouldResemble, []TableStats{
+				{Name: "guest", V4: 2}, {Name: "main", V4: 2, V6: 1}, {Name: "vpn", V4: 2},
+			})
+			So(ts.Names(), ShouldResemble, []string{"guest", "main", "vpn"})
+			So(ts.Remove("vpn"), ShouldBeTrue)
+			So(ts.Remove("vpn"), ShouldBeFalse)
+			So(ts.Get("vpn"), ShouldBeNil)
+		})
+
+		Convey("Save and load the set", func() {
+			ts.Table("main").AddExcept("192.0.2.0/24", []string{"192.0.2.128/25"}, map[string]interface{}{"nh": "a"})
+			var buf bytes.Buffer
+			So(ts.Save(&buf), ShouldBeNil)
+
+			loaded, err := LoadTableSet(&buf, ArchRadix)
+			So(err, ShouldBeNil)
+			So(loaded.Names(), ShouldResemble, ts.Names())
+			So(loaded.Rules(), ShouldResemble, ts.Rules())
+			for _, name := range ts.Names() {
+				So(len(Diff(ts.Get(name), loaded.Get(name), nil).Changed), ShouldEqual, 0)
+				So(tableSize(loaded.Get(name)), ShouldEqual, tableSize(ts.Get(name)))
+			}
+			So(loaded.Get("guest").Lookup("10.0.0.1").Type, ShouldEqual, RouteProhibit)
+			So(loaded.Get("main").Lookup("192.0.2.200").Entry, ShouldEqual, "isp")
+
+			_, err = LoadTableSet(bytes.NewBufferString(`{"tables":{"x":[{"prefix":"10.0.0.0/8","type":"bogus"}]}}`), ArchRadix)
+			So(err, ShouldBeError)
+		})
+	})
+
+	Convey("Leak typed and excluding entries to arena tables", t, func() {
+		ts := NewTableSet(ArchArena)
+		ts.Table("main").AddTyped("10.9.0.0/16", RouteBlackhole, nil)
+		ts.Table("main").AddExcept("11.0.0.0/8", []string{"11.1.0.0/16"}, "partial")
+		_, ok := ts.Get("main").V4.(*ArenaTable)
+		So(ok, ShouldBeTrue)
+
+		n, err := ts.Leak("main", "lab", mustCIDR("0.0.0.0/0"))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+		lab := ts.Get("lab")
+		So(lab.Lookup("10.9.1.1").Type, ShouldEqual, RouteBlackhole)
+		So(lab.Lookup("11.2.0.1").Entry, ShouldEqual, "partial")
+		So(lab.Lookup("11.1.0.1"), ShouldBeNil)
+		So(ts.Stats().V4, ShouldEqual, 4)
+	})
+}
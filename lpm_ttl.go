@@ -0,0 +1,146 @@
+package golpm
+
+import (
+	"container/heap"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// expiryIndex A min-heap of the entries with a TTL, by expiry time
+type expiryIndex struct {
+	entries []*Entry
+	pos     map[*Entry]int
+}
+
+func (ei *expiryIndex) Len() int { return len(ei.entries) }
+func (ei *expiryIndex) Less(i, j int) bool {
+	return ei.entries[i].Expires.Before(ei.entries[j].Expires)
+}
+
+func (ei *expiryIndex) Swap(i, j int) {
+	ei.entries[i], ei.entries[j] = ei.entries[j], ei.entries[i]
+	ei.pos[ei.entries[i]] = i
+	ei.pos[ei.entries[j]] = j
+}
+
+func (ei *expiryIndex) Push(x interface{}) {
+	entry := x.(*Entry)
+	ei.pos[entry] = len(ei.entries)
+	ei.entries = append(ei.entries, entry)
+}
+
+func (ei *expiryIndex) Pop() interface{} {
+	n := len(ei.entries) - 1
+	entry := ei.entries[n]
+	ei.entries[n] = nil
+	ei.entries = ei.entries[:n]
+	delete(ei.pos, entry)
+	return entry
+}
+
+// replace Drop oldEntry from the index and add newEntry when it expires.
+// The index must be allocated before an entry with an expiry time is added.
+func (ei *expiryIndex) replace(oldEntry, newEntry *Entry) {
+	if oldEntry != nil {
+		if i, ok := ei.pos[oldEntry]; ok {
+			heap.Remove(ei, i)
+		}
+	}
+	if newEntry != nil && !newEntry.Expires.IsZero() {
+		heap.Push(ei, newEntry)
+	}
+}
+
+// SetClock Set the function giving the current time to TTLs, time.Now when nil
+func (rt *RadixTable) SetClock(now func() time.Time) {
+	rt.clock = now
+}
+
+func (rt *RadixTable) now() time.Time {
+	if rt.clock == nil {
+		return time.Now()
+	}
+	return rt.clock()
+}
+
+// OnExpire Set the function called with each entry removed by Expire
+func (rt *RadixTable) OnExpire(fn func(entry *Entry)) {
+	rt.onExpire = fn
+}
+
+// AddWithTTL Add an entry for prefix that expires after ttl. Adding the
+// prefix again, with or without TTL, replaces the expiry time.
+func (rt *RadixTable) AddWithTTL(prefix string, entry interface{}, ttl time.Duration) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	return rt.AddIPNetWithTTL(ipNet, entry, ttl)
+}
+
+func (rt *RadixTable) AddIPNetWithTTL(prefix *net.IPNet, entry interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	if rt.expiry.pos == nil {
+		rt.expiry.pos = make(map[*Entry]int)
+	}
+	return rt.insert(&Entry{
+		Prefix:  prefix,
+		Entry:   entry,
+		Expires: rt.now().Add(ttl),
+	})
+}
+
+// Expire Remove the entries expired at now, returning them in expiry order.
+// The OnExpire function is called once they are all removed, so entries it
+// adds are left to the next call even when already expired.
+func (rt *RadixTable) Expire(now time.Time) []*Entry {
+	var expired []*Entry
+	for rt.expiry.Len() > 0 && !rt.expiry.entries[0].Expires.After(now) {
+		entry := rt.expiry.entries[0]
+		// removing the entry drops it from the index
+		rt.DeleteIPNet(entry.Prefix)
+		expired = append(expired, entry)
+	}
+	if rt.onExpire != nil {
+		for _, entry := range expired {
+			rt.onExpire(entry)
+		}
+	}
+	return expired
+}
+
+// StartExpiry Call Expire every interval in a new goroutine until the
+// returned function is called. The table is accessed with lock held, when
+// not nil.
+func (rt *RadixTable) StartExpiry(interval time.Duration, lock sync.Locker) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if lock != nil {
+					lock.Lock()
+				}
+				rt.Expire(rt.now())
+				if lock != nil {
+					lock.Unlock()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
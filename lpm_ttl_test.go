@@ -0,0 +1,122 @@
+package golpm
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRadixTable_Expire(t *testing.T) {
+	Convey("Expire entries with a TTL", t, func() {
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		table := NewRadixLPMTable(false).(*RadixTable)
+		table.SetClock(func() time.Time { return now })
+		var expired []string
+		table.OnExpire(func(entry *Entry) {
+			expired = append(expired, entry.Prefix.String())
+		})
+
+		So(table.Add("10.0.0.0/8", "static"), ShouldBeNil)
+		So(table.AddWithTTL("10.1.0.0/16", "a", time.Minute), ShouldBeNil)
+		So(table.AddWithTTL("10.2.0.0/16", "b", 2*time.Minute), ShouldBeNil)
+		So(table.AddWithTTL("0.0.0.0/0", "default", 3*time.Minute), ShouldBeNil)
+		So(table.AddWithTTL("10.3.0.0/16", "c", 0), ShouldBeError)
+		So(table.Get("10.1.0.0/16").Expires, ShouldEqual, now.Add(time.Minute))
+		So(table.Get("10.0.0.0/8").Expires.IsZero(), ShouldBeTrue)
+
+		So(table.Expire(now), ShouldBeEmpty)
+		So(len(table.Expire(now.Add(time.Minute))), ShouldEqual, 1)
+		So(table.Lookup("10.1.0.1").Entry, ShouldEqual, "static")
+		So(expired, ShouldResemble, []string{"10.1.0.0/16"})
+
+		Convey("Refresh the TTL on re-add", func() {
+			now = now.Add(90 * time.Second)
+			So(table.AddWithTTL("10.2.0.0/16", "b", 2*time.Minute), ShouldBeNil)
+			So(table.Expire(now.Add(time.Minute)), ShouldBeEmpty)
+			So(table.Lookup("10.2.0.1").Entry, ShouldEqual, "b")
+
+			entries := table.Expire(now.Add(5 * time.Minute))
+			So(len(entries), ShouldEqual, 2)
+			So(entries[0].Entry, ShouldEqual, "default")
+			So(entries[1].Entry, ShouldEqual, "b")
+			So(table.Lookup("192.0.2.1"), ShouldBeNil)
+		})
+
+		Convey("Drop the TTL when added without one", func() {
+			So(table.Add("10.2.0.0/16", "permanent"), ShouldBeNil)
+			So(table.Delete("0.0.0.0/0"), ShouldBeNil)
+			So(table.Expire(now.Add(time.Hour)), ShouldBeEmpty)
+			So(table.Lookup("10.2.0.1").Entry, ShouldEqual, "permanent")
+		})
+
+		Convey("Notify watchers of expired entries", func() {
+			var changes []DiffEntry
+			table.Watch("10.2.0.0/16", func(change DiffEntry) {
+				changes = append(changes, change)
+			})
+			table.Expire(now.Add(time.Hour))
+			So(len(changes), ShouldEqual, 2)
+			So(changes[0].Op, ShouldEqual, DiffRemoved)
+		})
+	})
+
+	Convey("Leave entries re-added expired by the callback to the next call", t, func() {
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		table := NewRadixLPMTable(false).(*RadixTable)
+		table.SetClock(func() time.Time { return now })
+		calls := 0
+		table.OnExpire(func(entry *Entry) {
+			calls++
+			// the new entry is already expired at the time Expire was given
+			So(table.AddIPNetWithTTL(entry.Prefix, entry.Entry, time.Second), ShouldBeNil)
+		})
+		So(table.AddWithTTL("10.0.0.0/8", "a", time.Second), ShouldBeNil)
+		So(table.AddWithTTL("10.1.0.0/16", "b", time.Second), ShouldBeNil)
+
+		So(len(table.Expire(now.Add(time.Hour))), ShouldEqual, 2)
+		So(calls, ShouldEqual, 2)
+		So(table.Lookup("10.1.0.1").Entry, ShouldEqual, "b")
+		So(len(table.Expire(now.Add(time.Hour))), ShouldEqual, 2)
+		So(calls, ShouldEqual, 4)
+	})
+
+	Convey("Allocate the expiry index only for TTLs", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		So(table.Add("10.0.0.0/8", "a"), ShouldBeNil)
+		So(table.Delete("10.0.0.0/8"), ShouldBeNil)
+		So(table.expiry.pos, ShouldBeNil)
+		So(table.Expire(time.Now()), ShouldBeEmpty)
+
+		set, _ := NewIPSet("10.0.0.0/8", "2001:db8::/32")
+		So(set.v4.expiry.pos, ShouldBeNil)
+		So(set.v6.expiry.pos, ShouldBeNil)
+
+		So(table.AddWithTTL("10.0.0.0/8", "a", time.Minute), ShouldBeNil)
+		So(table.expiry.pos, ShouldNotBeNil)
+	})
+
+	Convey("Expire entries in the background", t, func() {
+		var mu sync.Mutex
+		table := NewRadixLPMTable(true).(*RadixTable)
+		mu.Lock()
+		table.AddWithTTL("2001:db8::/32", "a", time.Millisecond)
+		mu.Unlock()
+
+		stop := table.StartExpiry(time.Millisecond, &mu)
+		defer stop()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			entry := table.Lookup("2001:db8::1")
+			mu.Unlock()
+			if entry == nil || time.Now().After(deadline) {
+				So(entry, ShouldBeNil)
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		stop()
+	})
+}
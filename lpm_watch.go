@@ -0,0 +1,130 @@
+package golpm
+
+import (
+	"net"
+	"sync"
+)
+
+type tableWatcher struct {
+	prefix *net.IPNet
+	fn     func(change DiffEntry)
+}
+
+// Watch Call fn after every change of a prefix that covers or is covered by
+// prefix, that is whenever lookups inside prefix may change. Call the
+// returned function to unsubscribe.
+func (rt *RadixTable) Watch(prefix string, fn func(change DiffEntry)) (func(), error) {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return rt.WatchIPNet(ipNet, fn), nil
+}
+
+func (rt *RadixTable) WatchIPNet(prefix *net.IPNet, fn func(change DiffEntry)) func() {
+	watcher := &tableWatcher{prefix: prefix, fn: fn}
+	rt.watchers = append(rt.watchers, watcher)
+	return func() {
+		for i, w := range rt.watchers {
+			if w == watcher {
+				// a new slice, so that a notification in progress is not disturbed
+				rt.watchers = append(rt.watchers[:i:i], rt.watchers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// WatchChan Like Watch, but deliver the changes on a channel. Changes are
+// queued without limit, so a slow consumer never blocks the table. The
+// returned function unsubscribes and closes the channel, dropping the
+// changes not received yet.
+func (rt *RadixTable) WatchChan(prefix string) (<-chan DiffEntry, func(), error) {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	ch, cancel := rt.WatchChanIPNet(ipNet)
+	return ch, cancel, nil
+}
+
+func (rt *RadixTable) WatchChanIPNet(prefix *net.IPNet) (<-chan DiffEntry, func()) {
+	var mu sync.Mutex
+	var queue []DiffEntry
+	wake := make(chan struct{}, 1)
+	done := make(chan struct{})
+	out := make(chan DiffEntry)
+
+	unwatch := rt.WatchIPNet(prefix, func(change DiffEntry) {
+		mu.Lock()
+		queue = append(queue, change)
+		mu.Unlock()
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	})
+
+	go func() {
+		defer close(out)
+		for {
+			mu.Lock()
+			if len(queue) == 0 {
+				mu.Unlock()
+				select {
+				case <-wake:
+					continue
+				case <-done:
+					return
+				}
+			}
+			change := queue[0]
+			queue[0] = DiffEntry{}
+			queue = queue[1:]
+			mu.Unlock()
+
+			select {
+			case out <- change:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return out, func() {
+		once.Do(func() {
+			unwatch()
+			close(done)
+		})
+	}
+}
+
+// notify Report the replacement of entry old by entry new to the watchers
+func (rt *RadixTable) notify(oldEntry, newEntry *Entry) {
+	if len(rt.watchers) == 0 || oldEntry == newEntry {
+		return
+	}
+	change := DiffEntry{Op: DiffChanged, Old: oldEntry, New: newEntry}
+	switch {
+	case oldEntry == nil:
+		change.Op, change.Prefix = DiffAdded, newEntry.Prefix
+	case newEntry == nil:
+		change.Op, change.Prefix = DiffRemoved, oldEntry.Prefix
+	default:
+		change.Prefix = newEntry.Prefix
+	}
+	for _, w := range rt.watchers {
+		if prefixesOverlap(w.prefix, change.Prefix) {
+			w.fn(change)
+		}
+	}
+}
+
+// prefixesOverlap Report whether one of a and b contains the other
+func prefixesOverlap(a, b *net.IPNet) bool {
+	if (a.IP.To4() == nil) != (b.IP.To4() == nil) {
+		return false
+	}
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
@@ -0,0 +1,88 @@
+package golpm
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRadixTable_Watch(t *testing.T) {
+	Convey("Notify changes of overlapping prefixes", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		var changes []string
+		cancel, err := table.Watch("10.1.0.0/16", func(change DiffEntry) {
+			changes = append(changes, fmt.Sprint(change.Op, " ", change.Prefix))
+		})
+		So(err, ShouldBeNil)
+
+		table.Add("10.0.0.0/8", "a")
+		table.Add("10.1.2.0/24", "b")
+		table.Add("10.2.0.0/16", "c")
+		table.Add("0.0.0.0/0", "default")
+		table.Add("10.1.2.0/24", "b2")
+		table.Delete("10.2.0.0/16")
+		table.Delete("10.1.2.0/24")
+		table.Delete("10.1.3.0/24")
+		So(changes, ShouldResemble, []string{
+			"added 10.0.0.0/8", "added 10.1.2.0/24", "added 0.0.0.0/0", "changed 10.1.2.0/24", "removed 10.1.2.0/24",
+		})
+
+		Convey("Stop notifying after unsubscribing", func() {
+			cancel()
+			cancel()
+			table.Add("10.1.0.0/16", "d")
+			So(len(changes), ShouldEqual, 5)
+		})
+
+		Convey("Notify entries with exclusions", func() {
+			changes = nil
+			table.AddExcept("10.1.0.0/16", []string{"10.1.1.0/24"}, "e")
+			So(changes, ShouldResemble, []string{"added 10.1.0.0/16"})
+			_, err := table.Watch("bad", nil)
+			So(err, ShouldBeError)
+		})
+	})
+
+	Convey("Let a watcher unsubscribe itself", t, func() {
+		table := NewRadixLPMTable(true).(*RadixTable)
+		calls := 0
+		var cancel func()
+		cancel, _ = table.Watch("2001:db8::/32", func(change DiffEntry) {
+			calls++
+			cancel()
+		})
+		other := 0
+		table.Watch("::/0", func(change DiffEntry) { other++ })
+		table.Add("2001:db8:1::/48", "a")
+		table.Add("2001:db8:2::/48", "b")
+		So(calls, ShouldEqual, 1)
+		So(other, ShouldEqual, 2)
+	})
+
+	Convey("Deliver changes on a channel", t, func() {
+		table := NewRadixLPMTable(false).(*RadixTable)
+		ch, cancel, err := table.WatchChan("10.0.0.0/8")
+		So(err, ShouldBeNil)
+
+		// nobody receives yet, the table must not block
+		for i := 0; i < 100; i++ {
+			table.Add(fmt.Sprintf("10.0.%d.0/24", i), i)
+		}
+		table.Add("192.168.0.0/16", "other")
+		for i := 0; i < 100; i++ {
+			change := <-ch
+			So(change.Op, ShouldEqual, DiffAdded)
+			So(change.New.Entry, ShouldEqual, i)
+		}
+
+		cancel()
+		select {
+		case _, ok := <-ch:
+			So(ok, ShouldBeFalse)
+		case <-time.After(time.Second):
+			So("channel not closed", ShouldBeEmpty)
+		}
+	})
+}